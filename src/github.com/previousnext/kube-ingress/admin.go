@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Headers which commonly carry credentials. Header names are case insensitive.
+const credentialHeaders = `(authorization|proxy-authorization|cookie|set-cookie|x-api-key|x-auth-token)`
+
+// Directives which can hold credentials have their values removed from dumps. Any
+// directive annotations add could set a credential header, so those are covered too.
+var redactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?mi)^(\s*(ssl_certificate_key|ssl_password_file|ssl_session_ticket_key|(proxy_set_header|add_header)\s+` + credentialHeaders + `)\s+)[^;]*;`),
+	regexp.MustCompile(`(?mi)^(\s*more_set_headers\s+)[^;]*\b` + credentialHeaders + `\s*:[^;]*;`),
+}
+
+// Checks the request has the admin token as a bearer token. Admin endpoints are
+// disabled while there is no token configured.
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	given := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// Wrap an admin handler so it can only be used with the admin token.
+func adminHandler(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, token) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Serves the configuration Nginx was last reloaded with. With ?source=disk the files
+// on disk are served instead, which Nginx isn't running if the last reload failed.
+func configHandler(n *Nginx, cfg, shardDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var dump string
+		if r.URL.Query().Get("source") == "disk" {
+			d, err := dumpConfig(cfg, shardDir)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			dump = "# Read from disk, Nginx is not running this if the last reload failed\n" + d
+		} else {
+			d, ok := n.Applied()
+			if !ok {
+				http.Error(w, "Nginx has not been reloaded yet", http.StatusServiceUnavailable)
+				return
+			}
+			dump = d
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, dump)
+	}
+}
+
+// Reports ok once the services have synced and Nginx has been configured with them.
+func healthzHandler(synced, configured chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-synced:
+		default:
+			http.Error(w, "Waiting for services to sync", http.StatusServiceUnavailable)
+			return
+		}
+
+		select {
+		case <-configured:
+			fmt.Fprintln(w, "ok")
+		default:
+			http.Error(w, "Waiting for Nginx to be configured", http.StatusServiceUnavailable)
+		}
+	}
+}
+
+// Queues a full resync of the controller, see requestResync.
+func resyncHandler(resync chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		requestResync(resync)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, "Resync queued")
+	}
+}
+
+// Queue a resync without blocking. Requests made while one is already queued are
+// folded into it.
+func requestResync(resync chan struct{}) {
+	select {
+	case resync <- struct{}{}:
+	default:
+	}
+}
+
+// Read the configuration from disk with credentials redacted. Include files from the
+// shard directory are appended when the configuration has been sharded.
+func dumpConfig(cfg, shardDir string) (string, error) {
+	data, err := ioutil.ReadFile(cfg)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Failed to read %v: %v", cfg, err))
+	}
+
+	includes := make(map[string]string)
+	if bytes.Contains(data, []byte("include "+shardDir+"/")) {
+		files, err := shardFiles(shardDir)
+		if err != nil {
+			return "", err
+		}
+		for _, path := range files {
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", errors.New(fmt.Sprintf("Failed to read %v: %v", path, err))
+			}
+			includes[path] = string(contents)
+		}
+	}
+
+	return formatDump(cfg, string(data), includes), nil
+}
+
+// Join a configuration and its include files into a single dump, each preceded by
+// a comment with its path, and redact any credentials.
+func formatDump(cfg, data string, includes map[string]string) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s\n", cfg)
+	b.WriteString(data)
+
+	var paths []string
+	for path := range includes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		fmt.Fprintf(&b, "\n# %s\n", path)
+		b.WriteString(includes[path])
+	}
+
+	dump := b.String()
+	for _, p := range redactPatterns {
+		dump = p.ReplaceAllString(dump, "${1}<redacted>;")
+	}
+	return dump
+}
+
+// Fetch the configuration from a running controller, or the files it last wrote
+// when disk is set.
+func configDumpCommand(url, token string, disk bool, w io.Writer) error {
+	endpoint := strings.TrimSuffix(url, "/") + "/config"
+	if disk {
+		endpoint += "?source=disk"
+	}
+
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(fmt.Sprintf("Failed to dump config: %s: %s", resp.Status, strings.TrimSpace(string(body))))
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
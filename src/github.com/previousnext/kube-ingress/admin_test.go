@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigDump(t *testing.T) {
+	fake, err := newFakeNginx()
+	assert.Nil(t, err)
+	defer fake.Close()
+
+	shardDir := filepath.Join(fake.Dir, "shards")
+	n, err := NewNginx("80", shardDir, 1)
+	assert.Nil(t, err)
+
+	ts := httptest.NewServer(adminHandler("token", configHandler(n, *cliCfg, shardDir)))
+	defer ts.Close()
+
+	err = configDumpCommand(ts.URL, "token", false, ioutil.Discard)
+	assert.NotNil(t, err, "Nothing to dump before the first reload")
+
+	n.SetServers(map[string][]routing.Location{
+		"foo": []routing.Location{
+			routing.Location{
+				Path:     "/",
+				Upstream: "foo",
+				Directives: []string{
+					`proxy_set_header Authorization "Basic c2VjcmV0"`,
+					`proxy_set_header authorization "Basic c2VjcmV0"`,
+					`proxy_set_header X-Api-Key c2VjcmV0`,
+					`more_set_headers "Cookie: session=c2VjcmV0"`,
+				},
+			},
+		},
+	})
+	n.SetUpstreams(map[string][]string{
+		"foo": []string{"1.2.3.4:80"},
+	})
+	assert.Nil(t, n.Reload())
+
+	err = configDumpCommand(ts.URL, "wrong", false, ioutil.Discard)
+	assert.NotNil(t, err, "The admin token is required")
+
+	var b bytes.Buffer
+	err = configDumpCommand(ts.URL, "token", false, &b)
+	assert.Nil(t, err)
+	assert.Contains(t, b.String(), "include "+shardDir+"/server-*.conf;")
+	assert.Contains(t, b.String(), "# "+filepath.Join(shardDir, "server-foo.conf"), "Include files are part of the dump")
+	assert.Contains(t, b.String(), "proxy_set_header Authorization <redacted>;")
+	assert.Contains(t, b.String(), "proxy_set_header authorization <redacted>;", "Header names are case insensitive")
+	assert.Contains(t, b.String(), "proxy_set_header X-Api-Key <redacted>;")
+	assert.Contains(t, b.String(), "more_set_headers <redacted>;")
+	assert.NotContains(t, b.String(), "c2VjcmV0", "Credentials are not part of the dump")
+
+	// A reload which Nginx rejects leaves the new files on disk.
+	err = fake.Fail(true)
+	assert.Nil(t, err)
+	n.SetUpstreams(map[string][]string{
+		"foo": []string{"1.2.3.5:80"},
+	})
+	assert.NotNil(t, n.Reload())
+
+	b.Reset()
+	err = configDumpCommand(ts.URL, "token", false, &b)
+	assert.Nil(t, err)
+	assert.Contains(t, b.String(), "server 1.2.3.4:80;", "The configuration Nginx is running")
+	assert.NotContains(t, b.String(), "server 1.2.3.5:80;")
+
+	b.Reset()
+	err = configDumpCommand(ts.URL, "token", true, &b)
+	assert.Nil(t, err)
+	assert.Contains(t, b.String(), "# Read from disk", "The files on disk are labeled")
+	assert.Contains(t, b.String(), "server 1.2.3.5:80;")
+	assert.NotContains(t, b.String(), "c2VjcmV0", "Credentials are not part of the dump")
+}
+
+func TestResync(t *testing.T) {
+	resync := make(chan struct{}, 1)
+
+	ts := httptest.NewServer(adminHandler("token", resyncHandler(resync)))
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", ts.URL+"/resync", nil)
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer token")
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, "Requests while a resync is queued don't block")
+	}
+
+	assert.Len(t, resync, 1, "Only one resync is queued")
+
+	req, err := http.NewRequest("POST", ts.URL+"/resync", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "token")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "The token has to be a bearer token")
+}
+
+func TestHealthz(t *testing.T) {
+	var (
+		synced     = make(chan struct{})
+		configured = make(chan struct{})
+	)
+
+	ts := httptest.NewServer(healthzHandler(synced, configured))
+	defer ts.Close()
+
+	status := func() int {
+		resp, err := http.Get(ts.URL)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, status(), "Not ready before services have synced")
+
+	close(synced)
+	assert.Equal(t, http.StatusServiceUnavailable, status(), "Not ready before Nginx has been configured")
+
+	close(configured)
+	assert.Equal(t, http.StatusOK, status())
+}
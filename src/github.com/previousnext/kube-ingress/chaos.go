@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Reload Nginx on every loop, even when nothing has changed.
+	ChaosReload = "reload"
+
+	// Drop a random endpoint from an upstream for a loop.
+	ChaosFlap = "flap"
+)
+
+var (
+	chaosFaults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_ingress_chaos_faults_total",
+		Help: "How many faults have been injected by chaos mode.",
+	}, []string{"fault"})
+
+	chaosRecovery = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name: "kube_ingress_chaos_recovery_seconds",
+		Help: "How long it took from a fault being injected until every probe succeeded again.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(chaosFaults)
+	prometheus.MustRegister(chaosRecovery)
+}
+
+// Chaos injects faults into the controller loop so operators can watch how Nginx
+// and their applications recover on a staging cluster. How long recovery takes is
+// recorded from the probe rounds, see Observe.
+type Chaos struct {
+	Faults map[string]bool
+	Rand   *rand.Rand
+
+	// When the first fault since every probe last succeeded was injected.
+	lock    sync.Mutex
+	faulted time.Time
+}
+
+// Apply the faults to a backend before it is handed to Nginx.
+func (c *Chaos) Inject(n *Nginx, b routing.Backend) routing.Backend {
+	if c.Faults[ChaosReload] {
+		n.ForceReload()
+		c.fault(ChaosReload)
+		fmt.Println("Chaos: forcing a reload")
+	}
+
+	if c.Faults[ChaosFlap] {
+		// Leave upstreams with a single endpoint alone, Nginx won't load an empty one.
+		var names []string
+		for name, addrs := range b.Upstreams {
+			if len(addrs) > 1 {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		if len(names) > 0 {
+			name := names[c.Rand.Intn(len(names))]
+			addrs := b.Upstreams[name]
+			drop := c.Rand.Intn(len(addrs))
+
+			// The addresses are shared with Services so we build new ones.
+			upstreams := make(map[string][]string)
+			for k, v := range b.Upstreams {
+				upstreams[k] = v
+			}
+			var flapped []string
+			flapped = append(flapped, addrs[:drop]...)
+			flapped = append(flapped, addrs[drop+1:]...)
+			upstreams[name] = flapped
+			b.Upstreams = upstreams
+
+			c.fault(ChaosFlap)
+			fmt.Printf("Chaos: dropped %s from %s\n", addrs[drop], name)
+		}
+	}
+
+	return b
+}
+
+// Count an injected fault, and start timing the recovery if it isn't already.
+func (c *Chaos) fault(name string) {
+	chaosFaults.WithLabelValues(name).Inc()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.faulted.IsZero() {
+		c.faulted = time.Now()
+	}
+}
+
+// Record the result of a probe round which started at started. The first round to
+// start after a fault and have every probe succeed marks the recovery.
+func (c *Chaos) Observe(started time.Time, healthy bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !healthy || c.faulted.IsZero() || started.Before(c.faulted) {
+		return
+	}
+
+	chaosRecovery.Observe(time.Since(c.faulted).Seconds())
+	c.faulted = time.Time{}
+}
+
+// Standard method for loading a Chaos object. Faults are only injected when allowed
+// is set as well, so chaos mode can't be turned on by a stray setting alone.
+func NewChaos(faults []string, allowed bool) (*Chaos, error) {
+	c := &Chaos{
+		Faults: make(map[string]bool),
+		Rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if len(faults) > 0 && !allowed {
+		return c, errors.New("Chaos mode also requires --allow-chaos")
+	}
+
+	for _, f := range faults {
+		if f != ChaosReload && f != ChaosFlap {
+			return c, errors.New(fmt.Sprintf("Unknown chaos fault %q, expected %s or %s", f, ChaosReload, ChaosFlap))
+		}
+		c.Faults[f] = true
+	}
+
+	return c, nil
+}
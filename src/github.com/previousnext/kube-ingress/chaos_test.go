@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/previousnext/kube-ingress/routing"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChaos(t *testing.T) {
+	_, err := NewChaos([]string{"meteor"}, true)
+	assert.NotNil(t, err, "Only known faults can be injected")
+
+	_, err = NewChaos([]string{ChaosReload}, false)
+	assert.NotNil(t, err, "Faults are only injected when chaos mode is allowed")
+
+	c, err := NewChaos([]string{ChaosReload, ChaosFlap}, true)
+	assert.Nil(t, err)
+
+	ings, svcs := generateCluster(2, 1)
+	svcs.List["ns1-svc1"] = []string{"10.0.1.0:80", "10.0.1.1:80"}
+	b := routing.Build(ings, svcs)
+
+	n := &Nginx{
+		Prev: b,
+	}
+	flapped := c.Inject(n, b)
+
+	assert.Nil(t, n.Prev.Servers, "Nginx will be reloaded")
+	assert.Len(t, flapped.Upstreams["ns0-svc0"], 1, "Upstreams with a single endpoint are left alone")
+	assert.Len(t, flapped.Upstreams["ns1-svc1"], 1, "An endpoint was dropped")
+	assert.Len(t, svcs.List["ns1-svc1"], 2, "The services are not changed")
+}
+
+func TestChaosRecovery(t *testing.T) {
+	c, err := NewChaos([]string{ChaosReload}, true)
+	assert.Nil(t, err)
+
+	before := time.Now()
+	c.Inject(&Nginx{}, routing.Backend{})
+
+	c.Observe(before, true)
+	assert.Equal(t, uint64(0), recoveries(t), "A round which started before the fault doesn't count")
+
+	c.Observe(time.Now(), false)
+	assert.Equal(t, uint64(0), recoveries(t), "Every probe has to succeed")
+
+	c.Observe(time.Now(), true)
+	assert.Equal(t, uint64(1), recoveries(t))
+
+	c.Observe(time.Now(), true)
+	assert.Equal(t, uint64(1), recoveries(t), "Only the first healthy round after a fault is recorded")
+}
+
+func recoveries(t *testing.T) uint64 {
+	var m dto.Metric
+	err := chaosRecovery.Write(&m)
+	assert.Nil(t, err)
+	return m.GetSummary().GetSampleCount()
+}
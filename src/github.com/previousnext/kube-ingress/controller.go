@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/previousnext/kube-ingress/routing"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// A Controller runs one pass of the controller loop at a time: build the routing
+// table from the ingresses and services, reload Nginx with it and tell the prober.
+type Controller struct {
+	Ingresses client.IngressInterface
+	Services  *Services
+	Nginx     *Nginx
+
+	// Optional, faults are injected before reloading and routes are probed once
+	// Nginx is serving them.
+	Chaos  *Chaos
+	Prober *Prober
+
+	// Closed after the first successful reload.
+	Configured     chan struct{}
+	configuredOnce sync.Once
+}
+
+// Reload Nginx with the current ingresses. Nginx is left alone when there are no
+// ingresses.
+func (c *Controller) Sync() error {
+	// Query for the current list of ingresses.
+	ings, err := c.Ingresses.List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error retrieving ingresses: %v", err))
+	}
+
+	// Ensure we have ingress items.
+	if len(ings.Items) <= 0 {
+		return errors.New("No ingresses were found")
+	}
+
+	b := routing.Build(ings.Items, c.Services)
+	if c.Chaos != nil {
+		b = c.Chaos.Inject(c.Nginx, b)
+	}
+
+	// Add the upstreams and servers to the nginx configuration.
+	c.Nginx.SetServers(b.Servers)
+	c.Nginx.SetUpstreams(b.Upstreams)
+	c.Nginx.SetDirectives(b.Directives)
+	c.Nginx.SetServerDirectives(b.ServerDirectives)
+
+	err = c.Nginx.Reload()
+	if err != nil {
+		return err
+	}
+
+	c.configuredOnce.Do(func() {
+		close(c.Configured)
+	})
+
+	// Only probe the routes once Nginx is serving them.
+	if c.Prober != nil {
+		c.Prober.SetServers(b.Servers)
+	}
+
+	return nil
+}
+
+// Load every service again and make the next Sync reload Nginx, even if nothing
+// has changed.
+func (c *Controller) Resync() error {
+	err := c.Services.Load()
+	c.Nginx.ForceReload()
+	return err
+}
+
+// Standard method for loading a Controller object.
+func NewController(ings client.IngressInterface, svcs *Services, n *Nginx) *Controller {
+	return &Controller{
+		Ingresses:  ings,
+		Services:   svcs,
+		Nginx:      n,
+		Configured: make(chan struct{}),
+	}
+}
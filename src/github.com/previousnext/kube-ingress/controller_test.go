@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControllerSync(t *testing.T) {
+	h := NewHarness(t)
+	defer h.Close()
+
+	h.AddService("shop", "web", 1)
+	err := h.Services.Load()
+	assert.Nil(t, err)
+
+	err = h.Controller.Sync()
+	assert.Equal(t, "No ingresses were found", err.Error(), "Nginx is left alone without ingresses")
+	_, ok := h.Nginx.Applied()
+	assert.False(t, ok)
+
+	select {
+	case <-h.Controller.Configured:
+		t.Fatal("Not configured until Nginx has been reloaded")
+	default:
+	}
+
+	h.AddIngress("shop", "shop", "shop.example.com", map[string]string{"/": "web"})
+	assert.Nil(t, h.Controller.Sync())
+	assert.Equal(t, errNotChanged, h.Controller.Sync(), "Nginx is only reloaded when the configuration changes")
+
+	select {
+	case <-h.Controller.Configured:
+	default:
+		t.Fatal("Configured after the first reload")
+	}
+
+	assert.Nil(t, h.Controller.Resync())
+	assert.Nil(t, h.Controller.Sync(), "A resync reloads Nginx again")
+}
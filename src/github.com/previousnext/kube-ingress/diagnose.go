@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// Load the ingresses and every service, then report on how the host is routed. All
+// of the services are needed as any of them could back the default server.
+// Progress is logged to log so w only holds the report.
+func diagnoseCommand(c client.Interface, w, log io.Writer, host, path string) error {
+	ings, err := c.Extensions().Ingress(api.NamespaceAll).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return err
+	}
+
+	svcs := &Services{
+		Client:  c,
+		List:    make(map[string][]string),
+		Workers: *cliSyncWorkers,
+		Synced:  make(chan struct{}),
+		Log:     log,
+	}
+	err = svcs.Load()
+	if err != nil {
+		return err
+	}
+
+	Diagnose(w, ings.Items, svcs, host, path)
+	return nil
+}
+
+// Write a report of how a request for the host and path gets routed. The route comes
+// from Build and Match, the same as the configuration Nginx is given.
+func Diagnose(w io.Writer, ings []extensions.Ingress, svcs *Services, host, path string) {
+	fmt.Fprintf(w, "Host: %s\n", host)
+	fmt.Fprintf(w, "Path: %s\n", path)
+
+	b := routing.Build(ings, svcs)
+
+	var defined []string
+	for _, i := range ings {
+		for _, r := range i.Spec.Rules {
+			if r.Host == host && r.HTTP != nil {
+				defined = append(defined, i.ObjectMeta.Namespace+"/"+i.ObjectMeta.Name)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "\nIngresses:")
+	if len(defined) <= 0 {
+		fmt.Fprintln(w, "  No ingress defines this host")
+	}
+	for _, name := range defined {
+		fmt.Fprintf(w, "  %s\n", name)
+	}
+
+	locations, ok := b.Servers[host]
+	if !ok {
+		fmt.Fprintln(w, "\nRoute:")
+		if def, ok := b.DefaultServer(); ok {
+			fmt.Fprintf(w, "  No working server for this host, Nginx will answer with its default server (%s)\n", def)
+		} else {
+			fmt.Fprintln(w, "  No working servers, Nginx will not answer for this host")
+		}
+		return
+	}
+
+	var winner extensions.Ingress
+	for _, i := range ings {
+		if i.ObjectMeta.Namespace+"/"+i.ObjectMeta.Name == locations[0].Ingress {
+			winner = i
+		}
+	}
+
+	if len(defined) > 1 {
+		fmt.Fprintln(w, "\nConflicts:")
+		fmt.Fprintf(w, "  %d rules define this host, only the rule from %s is used\n", len(defined), locations[0].Ingress)
+	}
+
+	// Build leaves out the paths of the winning ingress which have no running pods.
+	var unusable []string
+	for _, r := range winner.Spec.Rules {
+		if r.Host != host || r.HTTP == nil {
+			continue
+		}
+		for _, pa := range r.HTTP.Paths {
+			if _, err := svcs.Get(routing.MergeNameNameSpace(winner.ObjectMeta.Namespace, pa.Backend.ServiceName)); err != nil {
+				unusable = append(unusable, pa.Path)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "\nRoute:")
+	fmt.Fprintf(w, "  Ingress:   %s\n", locations[0].Ingress)
+	for _, p := range unusable {
+		fmt.Fprintf(w, "  Skipped:   %s, the service has no running pods\n", p)
+	}
+	if location, ok := b.Match(host, path); !ok {
+		fmt.Fprintln(w, "  Location:  No location matches this path, Nginx will return a 404")
+	} else {
+		service := strings.TrimPrefix(location.Upstream, winner.ObjectMeta.Namespace+"-")
+
+		fmt.Fprintf(w, "  Location:  %s\n", location.Path)
+		fmt.Fprintf(w, "  Service:   %s/%s\n", winner.ObjectMeta.Namespace, service)
+		fmt.Fprintf(w, "  Upstream:  %s\n", location.Upstream)
+		fmt.Fprintln(w, "  Endpoints:")
+		for _, e := range b.Upstreams[location.Upstream] {
+			fmt.Fprintf(w, "    %s\n", e)
+		}
+	}
+
+	fmt.Fprintln(w, "\nAnnotations:")
+	if len(winner.ObjectMeta.Annotations) <= 0 {
+		fmt.Fprintln(w, "  None")
+	}
+	var keys []string
+	for k := range winner.ObjectMeta.Annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		registered, allowed := routing.AnnotationRegistered(winner.ObjectMeta.Namespace, k)
+		switch {
+		case registered && allowed:
+			fmt.Fprintf(w, "  %s: %s (applied)\n", k, winner.ObjectMeta.Annotations[k])
+		case registered:
+			fmt.Fprintf(w, "  %s: %s (not allowed in this namespace)\n", k, winner.ObjectMeta.Annotations[k])
+		default:
+			fmt.Fprintf(w, "  %s: %s\n", k, winner.ObjectMeta.Annotations[k])
+		}
+	}
+
+	fmt.Fprintln(w, "\nTLS:")
+	fmt.Fprintln(w, "  None, only plain HTTP servers are configured")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing/routingtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnose(t *testing.T) {
+	ings, svcs := generateCluster(2, 2)
+
+	// Another ingress claims the first host but its service has no pods.
+	extra, _ := generateCluster(2, 2)
+	conflict := extra[1]
+	conflict.ObjectMeta.Annotations = map[string]string{
+		"example.com/owner": "team-b",
+	}
+	conflict.Spec.Rules[0].Host = "svc0.example.com"
+	conflict.Spec.Rules[0].HTTP.Paths[0].Backend.ServiceName = "missing"
+	conflict.ObjectMeta.Name = "conflict"
+	ings = append(ings, conflict)
+
+	var b bytes.Buffer
+	Diagnose(&b, ings, svcs, "svc0.example.com", "/foo")
+	report := b.String()
+
+	assert.Contains(t, report, "ns0/svc0\n  ns1/conflict\n", "Both ingresses for the host are listed")
+	assert.Contains(t, report, "only the rule from ns0/svc0 is used", "The conflict is reported")
+	assert.Contains(t, report, "Upstream:  ns0-svc0", "The upstream Nginx proxies to")
+	assert.Contains(t, report, "10.0.0.1:80", "The endpoints of the upstream")
+
+	// Rules without HTTP paths are valid and don't stop the default server being found.
+	empty, _ := generateCluster(1, 1)
+	empty[0].Spec.Rules[0].HTTP = nil
+	ings = append(ings, empty[0])
+
+	b.Reset()
+	Diagnose(&b, ings, svcs, "unknown.example.com", "/")
+	assert.Contains(t, b.String(), "default server (svc0.example.com)", "Unknown hosts get the default server")
+}
+
+func TestDiagnoseCommand(t *testing.T) {
+	c, err := fakeClient(routingtest.ClusterObjects(2, 1))
+	assert.Nil(t, err)
+
+	var out, log bytes.Buffer
+	err = diagnoseCommand(c, &out, &log, "svc1.example.com", "/")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "Upstream:  ns1-svc1")
+
+	out.Reset()
+	err = diagnoseCommand(c, &out, &log, "unknown.example.com", "/")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "default server (svc0.example.com)", "Services for other hosts are loaded to find the default server")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/previousnext/kube-ingress/routing"
+	"k8s.io/kubernetes/pkg/api"
+	client "k8s.io/kubernetes/pkg/client/unversioned"
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+)
+
+// Reconcile the cluster once and print the changes which would be made to the
+// configuration, without writing it or reloading Nginx. Progress is logged to log
+// so w only holds the report.
+func dryRunCommand(c client.Interface, w, log io.Writer) error {
+	svcs := &Services{
+		Client:  c,
+		List:    make(map[string][]string),
+		Workers: *cliSyncWorkers,
+		Synced:  make(chan struct{}),
+		Log:     log,
+	}
+	err := svcs.Load()
+	if err != nil {
+		return err
+	}
+
+	ings, err := c.Extensions().Ingress(api.NamespaceAll).List(labels.Everything(), fields.Everything())
+	if err != nil {
+		return err
+	}
+
+	// The controller doesn't touch Nginx until there are ingresses.
+	if len(ings.Items) <= 0 {
+		fmt.Fprintln(w, "No ingresses were found, Nginx would not be reloaded")
+		return nil
+	}
+
+	n, err := NewNginx(*cliPort, *cliShardDir, int(*cliShardSize))
+	if err != nil {
+		return err
+	}
+
+	b := routing.Build(ings.Items, svcs)
+	n.SetServers(b.Servers)
+	n.SetUpstreams(b.Upstreams)
+	n.SetDirectives(b.Directives)
+	n.SetServerDirectives(b.ServerDirectives)
+
+	// A configuration which hasn't been written yet is the same as an empty one.
+	var current string
+	if _, err := os.Stat(*cliCfg); err == nil {
+		current, err = dumpConfig(*cliCfg, *cliShardDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	proposed, err := proposedConfig(n, *cliCfg)
+	if err != nil {
+		return err
+	}
+
+	return DryRun(w, current, proposed, *cliCfg)
+}
+
+// Render the configuration for the new values in the same form as dumpConfig.
+func proposedConfig(n *Nginx, cfg string) (string, error) {
+	f, err := n.Render()
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	err = n.Write(&b, f)
+	if err != nil {
+		return "", err
+	}
+
+	includes := make(map[string]string)
+	if n.Sharded(f) {
+		includes = n.Shards(f)
+	}
+
+	return formatDump(cfg, b.String(), includes), nil
+}
+
+// Write a unified diff between the current and proposed configuration.
+func DryRun(w io.Writer, current, proposed, cfg string) error {
+	if current == proposed {
+		fmt.Fprintln(w, "No changes, Nginx would not be reloaded")
+		return nil
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(current),
+		B:        difflib.SplitLines(proposed),
+		FromFile: cfg + " (current)",
+		ToFile:   cfg + " (proposed)",
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(w, diff)
+	fmt.Fprintln(w, "\nNginx would be reloaded with these changes")
+	return nil
+}
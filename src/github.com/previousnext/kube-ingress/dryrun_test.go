@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/previousnext/kube-ingress/routing/routingtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	ings, svcs := generateCluster(1, 1)
+
+	n, err := NewNginx("80", "", 0)
+	assert.Nil(t, err)
+	b := routing.Build(ings, svcs)
+	n.SetServers(b.Servers)
+	n.SetUpstreams(b.Upstreams)
+
+	current, err := proposedConfig(n, "nginx.conf")
+	assert.Nil(t, err)
+
+	var out bytes.Buffer
+	err = DryRun(&out, current, current, "nginx.conf")
+	assert.Nil(t, err)
+	assert.Equal(t, "No changes, Nginx would not be reloaded\n", out.String())
+
+	// A new pod for the service.
+	svcs.List["ns0-svc0"] = append(svcs.List["ns0-svc0"], "10.0.0.9:80")
+	n.SetUpstreams(routing.Build(ings, svcs).Upstreams)
+	proposed, err := proposedConfig(n, "nginx.conf")
+	assert.Nil(t, err)
+
+	out.Reset()
+	err = DryRun(&out, current, proposed, "nginx.conf")
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "+        server 10.0.0.9:80;", "The new address is part of the diff")
+	assert.NotContains(t, out.String(), "-        server 10.0.0.0:80;", "Unchanged addresses are kept")
+}
+
+func TestDryRunCommand(t *testing.T) {
+	defer func(cfg string) {
+		*cliCfg = cfg
+	}(*cliCfg)
+	*cliCfg = "/nonexistent/nginx.conf"
+
+	c, err := fakeClient(nil)
+	assert.Nil(t, err)
+
+	var out, log bytes.Buffer
+	err = dryRunCommand(c, &out, &log)
+	assert.Nil(t, err)
+	assert.Equal(t, "No ingresses were found, Nginx would not be reloaded\n", out.String(), "The controller doesn't reload without ingresses")
+
+	c, err = fakeClient(routingtest.ClusterObjects(1, 1))
+	assert.Nil(t, err)
+
+	out.Reset()
+	err = dryRunCommand(c, &out, &log)
+	assert.Nil(t, err)
+	assert.Contains(t, out.String(), "+        server 10.0.0.0:80;")
+	assert.NotContains(t, out.String(), "Added pod", "Progress is logged separately from the report")
+	assert.Contains(t, log.String(), "Added pod svc0-0 for service ns0-svc0")
+}
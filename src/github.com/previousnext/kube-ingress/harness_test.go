@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing/routingtest"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/unversioned/testclient"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// A Harness runs the sync path against a fake Kubernetes API, renders the Nginx
+// configuration and routes requests to in-process echo backends with a
+// routingtest.Harness. The routing is decided by the routing table, not by Nginx, so
+// anything only Nginx does has to be checked against Config.
+//
+//	h := NewHarness(t)
+//	defer h.Close()
+//	h.AddService("default", "web", 2)
+//	h.AddIngress("default", "web", "example.com", map[string]string{"/": "web"})
+//	h.Sync()
+//	resp := h.Get("example.com", "/")
+type Harness struct {
+	*routingtest.Harness
+
+	T          *testing.T
+	Client     *testclient.Fake
+	Services   *Services
+	Nginx      *Nginx
+	Controller *Controller
+
+	// The configuration Nginx was given by the last Sync.
+	Config string
+
+	objects testclient.ObjectRetriever
+	pods    int
+	fake    *fakeNginx
+}
+
+// Add a service backed by a number of running pods, each with their own echo
+// backend named namespace/service/pod.
+func (h *Harness) AddService(namespace, name string, replicas int) {
+	selector := map[string]string{
+		"kube-ingress-harness": namespace + "." + name,
+	}
+
+	h.add(&api.Service{
+		ObjectMeta: api.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: api.ServiceSpec{
+			Selector: selector,
+		},
+	})
+
+	for r := 0; r < replicas; r++ {
+		h.pods++
+		pod := fmt.Sprintf("%s-%d", name, r)
+		ip := fmt.Sprintf("10.%d.%d.%d", h.pods/65536%256, h.pods/256%256, h.pods%256)
+
+		h.add(&api.Pod{
+			ObjectMeta: api.ObjectMeta{
+				Name:      pod,
+				Namespace: namespace,
+				Labels:    selector,
+			},
+			Status: api.PodStatus{
+				Phase: api.PodRunning,
+				PodIP: ip,
+			},
+		})
+
+		h.AddBackend(ip+":80", namespace+"/"+name+"/"+pod)
+	}
+}
+
+// Add an ingress routing paths on a host to services in its namespace.
+func (h *Harness) AddIngress(namespace, name, host string, paths map[string]string, annotations ...map[string]string) {
+	ing := routingtest.Ingress(namespace, name, host, paths)
+	if len(annotations) > 0 {
+		ing.ObjectMeta.Annotations = annotations[0]
+	}
+	h.add(&ing)
+}
+
+func (h *Harness) add(obj runtime.Object) {
+	err := h.objects.Add(obj)
+	if err != nil {
+		h.T.Fatal(err)
+	}
+}
+
+// Load the services, then run a pass of the controller loop against a stub nginx.
+func (h *Harness) Sync() {
+	err := h.Services.Load()
+	if err != nil {
+		h.T.Fatal(err)
+	}
+
+	err = h.Controller.Sync()
+	if err != nil && err != errNotChanged {
+		h.T.Fatal(err)
+	}
+
+	h.Backend = h.Nginx.Prev
+
+	cfg, err := ioutil.ReadFile(*cliCfg)
+	if err != nil {
+		h.T.Fatal(err)
+	}
+	h.Config = string(cfg)
+}
+
+// Stop the echo backends and put back the stub nginx.
+func (h *Harness) Close() {
+	h.Harness.Close()
+	h.fake.Close()
+}
+
+// Send a request to the backend the routing table gives for a host and path.
+func (h *Harness) Get(host, path string) routingtest.Response {
+	resp, err := h.Harness.Get(host, path)
+	if err != nil {
+		h.T.Fatal(err)
+	}
+	return resp
+}
+
+// Standard method for loading a Harness object.
+func NewHarness(t *testing.T) *Harness {
+	objects := testclient.NewObjects(api.Scheme, api.Scheme)
+
+	c := &testclient.Fake{}
+	c.AddReactor("*", "*", testclient.ObjectReaction(objects, api.RESTMapper))
+
+	fake, err := newFakeNginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NewNginx("80", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svcs := &Services{
+		Client:  c,
+		List:    make(map[string][]string),
+		Workers: 1,
+		Synced:  make(chan struct{}),
+	}
+
+	return &Harness{
+		Harness:    routingtest.NewHarness(),
+		T:          t,
+		Client:     c,
+		Services:   svcs,
+		Nginx:      n,
+		Controller: NewController(c.Extensions().Ingress(api.NamespaceAll), svcs, n),
+		objects:    objects,
+		fake:       fake,
+	}
+}
+
+func TestHarness(t *testing.T) {
+	h := NewHarness(t)
+	defer h.Close()
+
+	h.AddService("shop", "web", 2)
+	h.AddService("shop", "api", 1)
+	h.AddService("blog", "web", 1)
+	h.AddIngress("shop", "shop", "shop.example.com", map[string]string{
+		"/":    "web",
+		"/api": "api",
+	})
+	h.AddIngress("blog", "blog", "blog.example.com", map[string]string{
+		"/": "web",
+	})
+	h.Sync()
+
+	resp := h.Get("shop.example.com", "/api/v1/cart")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "shop/api/api-0", resp.Backend, "The longest prefix wins")
+	assert.Equal(t, "GET shop.example.com/api/v1/cart\n", resp.Body, "The host and path are passed to the backend")
+
+	resp = h.Get("shop.example.com", "/checkout")
+	assert.Equal(t, "shop/web/web-0", resp.Backend)
+
+	resp = h.Get("blog.example.com", "/")
+	assert.Equal(t, "blog/web/web-0", resp.Backend, "Services are scoped to the namespace of the ingress")
+
+	resp = h.Get("unknown.example.com", "/")
+	assert.Equal(t, "blog/web/web-0", resp.Backend, "Unknown hosts are answered by the default server")
+
+	assert.Contains(t, h.Config, "server_name shop.example.com;")
+	assert.Contains(t, h.Config, "location /api {\n            proxy_pass http://shop-api;", "Nginx is given the same route")
+
+	// Syncing again without changes doesn't reload Nginx.
+	h.Sync()
+	assert.Contains(t, h.Config, "server_name shop.example.com;")
+}
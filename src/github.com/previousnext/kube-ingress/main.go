@@ -2,12 +2,16 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/alecthomas/kingpin"
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/kubernetes/pkg/api"
 	client "k8s.io/kubernetes/pkg/client/unversioned"
-	"k8s.io/kubernetes/pkg/fields"
-	"k8s.io/kubernetes/pkg/labels"
 	"k8s.io/kubernetes/pkg/util"
 )
 
@@ -15,10 +19,48 @@ var (
 	cliApi  = kingpin.Flag("api", "URL to the Kubernetes API component").Default("http://localhost").OverrideDefaultFromEnvar("KUBE_NGINX_API").String()
 	cliPort = kingpin.Flag("port", "Port to accept incoming connections on").Default("80").OverrideDefaultFromEnvar("KUBE_NGINX_PORT").String()
 	cliCfg  = kingpin.Flag("cfg", "Nginx config file").Default("/etc/nginx/nginx.conf").OverrideDefaultFromEnvar("KUBE_NGINX_CFG").String()
+
+	cliShardDir  = kingpin.Flag("shard-dir", "Directory to write server-*.conf and upstream-*.conf include files to").Default("/etc/nginx/kube-ingress.d").OverrideDefaultFromEnvar("KUBE_NGINX_SHARD_DIR").String()
+	cliShardSize = kingpin.Flag("shard-size", "Split the config into include files once it is larger than this (0 disables)").Default("1MB").OverrideDefaultFromEnvar("KUBE_NGINX_SHARD_SIZE").Bytes()
+
+	cliMetrics       = kingpin.Flag("metrics", "Address to serve Prometheus metrics, health checks and admin endpoints on").Default(":9100").OverrideDefaultFromEnvar("KUBE_NGINX_METRICS").String()
+	cliAdminToken    = kingpin.Flag("admin-token", "Bearer token required by the admin endpoints (disabled when empty)").OverrideDefaultFromEnvar("KUBE_NGINX_ADMIN_TOKEN").String()
+	cliSyncTimeout   = kingpin.Flag("sync-timeout", "How long to wait for services to load before configuring Nginx").Default("60s").OverrideDefaultFromEnvar("KUBE_NGINX_SYNC_TIMEOUT").Duration()
+	cliSyncWorkers   = kingpin.Flag("sync-workers", "How many services to load pods for at the same time").Default("10").OverrideDefaultFromEnvar("KUBE_NGINX_SYNC_WORKERS").Int()
+	cliProbeInterval = kingpin.Flag("probe-interval", "How often to send synthetic requests to each host and path").Default("30s").OverrideDefaultFromEnvar("KUBE_NGINX_PROBE_INTERVAL").Duration()
+	cliProbeWorkers  = kingpin.Flag("probe-workers", "How many synthetic requests to send at the same time").Default("10").OverrideDefaultFromEnvar("KUBE_NGINX_PROBE_WORKERS").Int()
+
+	cliChaos      = kingpin.Flag("chaos", "Inject faults for resilience testing: reload, flap. Never use this in production").OverrideDefaultFromEnvar("KUBE_NGINX_CHAOS").Strings()
+	cliAllowChaos = kingpin.Flag("allow-chaos", "Confirm that --chaos should inject faults. Can only be set on the command line").Bool()
+
+	cliAllowAnnotations = kingpin.Flag("allow-annotation", "Allow restricted annotations in a namespace, eg. team-a=example.com/snippet (* for every namespace)").OverrideDefaultFromEnvar("KUBE_NGINX_ALLOW_ANNOTATION").Strings()
+
+	cmdController = kingpin.Command("controller", "Run the Ingress controller").Default()
+
+	cmdConfig         = kingpin.Command("config", "Inspect the configuration of a running controller")
+	cmdConfigDump     = cmdConfig.Command("dump", "Print the configuration Nginx was last reloaded with, with credentials redacted")
+	cmdConfigDumpURL  = cmdConfigDump.Flag("url", "URL of the controller's admin endpoints").Default("http://localhost:9100").String()
+	cmdConfigDumpDisk = cmdConfigDump.Flag("disk", "Print the files on disk instead, which Nginx isn't running if the last reload failed").Bool()
+
+	cmdDryRun = kingpin.Command("dry-run", "Print the changes the controller would make to the Nginx configuration, then exit")
+
+	cmdDiagnose     = kingpin.Command("diagnose", "Report how a request for a host and path is routed")
+	cmdDiagnoseHost = cmdDiagnose.Arg("host", "Host of the request").Required().String()
+	cmdDiagnosePath = cmdDiagnose.Arg("path", "Path of the request").Default("/").String()
 )
 
 func main() {
-	kingpin.Parse()
+	cmd := kingpin.Parse()
+
+	// Only needs to talk to the controller, not Kubernetes.
+	if cmd == cmdConfigDump.FullCommand() {
+		err := configDumpCommand(*cmdConfigDumpURL, *cliAdminToken, *cmdConfigDumpDisk, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Create a client which we can use to connect to the remote Kubernetes cluster.
 	kubeClient, err := client.New(&client.Config{
@@ -28,80 +70,120 @@ func main() {
 		panic(err)
 	}
 
+	policy, err := routing.ParseAnnotationPolicy(*cliAllowAnnotations)
+	if err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	routing.SetAnnotationPolicy(policy)
+	// The one-shot commands print a report to stdout, so everything else is logged to
+	// stderr.
+	log := os.Stdout
+	if cmd != cmdController.FullCommand() {
+		log = os.Stderr
+	}
+	routing.SetLogger(func(format string, args ...interface{}) {
+		fmt.Fprintf(log, format+"\n", args...)
+	})
+
+	switch cmd {
+	case cmdDiagnose.FullCommand():
+		err := diagnoseCommand(kubeClient, os.Stdout, log, *cmdDiagnoseHost, *cmdDiagnosePath)
+		if err != nil {
+			fmt.Fprintln(log, err)
+			os.Exit(1)
+		}
+	case cmdDryRun.FullCommand():
+		err := dryRunCommand(kubeClient, os.Stdout, log)
+		if err != nil {
+			fmt.Fprintln(log, err)
+			os.Exit(1)
+		}
+	case cmdController.FullCommand():
+		controller(kubeClient)
+	}
+}
+
+func controller(kubeClient client.Interface) {
 	var (
-		ingClient = kubeClient.Extensions().Ingress(api.NamespaceAll)
-		rl        = util.NewTokenBucketRateLimiter(0.1, 1)
-		svcs      = NewServices(kubeClient)
+		rl   = util.NewTokenBucketRateLimiter(0.1, 1)
+		svcs = NewServices(kubeClient, *cliSyncWorkers)
 	)
 
-	nginx, err := NewNginx(*cliPort)
+	nginx, err := NewNginx(*cliPort, *cliShardDir, int(*cliShardSize))
 	if err != nil {
 		panic(err)
 	}
+	c := NewController(kubeClient.Extensions().Ingress(api.NamespaceAll), svcs, nginx)
 
-	// Controller loop.
-	for {
-		rl.Accept()
+	chaos, err := NewChaos(*cliChaos, *cliAllowChaos)
+	if err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	if len(chaos.Faults) > 0 {
+		fmt.Printf("Chaos mode is enabled, injecting faults: %v\n", *cliChaos)
+	}
+	c.Chaos = chaos
 
-		// Query for the current list of ingresses.
-		ings, err := ingClient.List(labels.Everything(), fields.Everything())
-		if err != nil {
-			fmt.Printf("Error retrieving ingresses: %v\n", err)
-			continue
+	// Send requests through Nginx so we find out about broken routes before our users do.
+	if *cliProbeInterval <= 0 {
+		kingpin.Fatalf("--probe-interval must be greater than zero, got %v", *cliProbeInterval)
+	}
+	prober := NewProber("127.0.0.1:"+*cliPort, *cliProbeInterval, *cliProbeWorkers)
+	if len(chaos.Faults) > 0 {
+		prober.OnRound(chaos.Observe)
+	}
+	c.Prober = prober
+
+	http.Handle("/metrics", prometheus.Handler())
+
+	// We aren't ready until Nginx is serving the ingresses.
+	http.Handle("/healthz", healthzHandler(svcs.Synced, c.Configured))
+
+	// A full resync can be requested with a SIGHUP or through the admin endpoint, for
+	// when the controller looks like it has drifted from the cluster.
+	resync := make(chan struct{}, 1)
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			requestResync(resync)
 		}
+	}()
+
+	http.Handle("/config", adminHandler(*cliAdminToken, configHandler(nginx, *cliCfg, *cliShardDir)))
+	http.Handle("/resync", adminHandler(*cliAdminToken, resyncHandler(resync)))
+	go func() {
+		panic(http.ListenAndServe(*cliMetrics, nil))
+	}()
+
+	// Don't configure Nginx until we know about the services, otherwise we would
+	// reload it with routes missing.
+	if !svcs.WaitForSync(*cliSyncTimeout) {
+		fmt.Println("Timed out waiting for services to sync, continuing with what has loaded")
+	}
 
-		// Ensure we have ingress items.
-		if len(ings.Items) <= 0 {
-			fmt.Printf("No ingresses were found\n", err)
-			continue
+	ticks := make(chan struct{})
+	go func() {
+		for {
+			rl.Accept()
+			ticks <- struct{}{}
 		}
+	}()
 
-		var (
-			servers   = make(map[string][]Location)
-			upstreams = make(map[string][]string)
-		)
-
-		// Load up the pods for the service in this ingress.
-		for _, i := range ings.Items {
-			// Build a our listeners based on the ingress rules.
-			for _, r := range i.Spec.Rules {
-				var locations []Location
-
-				for _, pa := range r.HTTP.Paths {
-					name := MergeNameNameSpace(i.ObjectMeta.Namespace, pa.Backend.ServiceName)
-
-					// Get the list of backends from this rule.
-					list, err := svcs.Get(name)
-					if err != nil {
-						fmt.Println("Failed to get service pods: %s", err)
-						continue
-					}
-
-					// We have a set of IPs so we are now free to add the upstream and location
-					// to our nginx configuration and be a part of the next reload.
-					upstreams[name] = list
-
-					// Add this to our list of paths to implement in Nginx.
-					l := Location{
-						Path:     pa.Path,
-						Upstream: name,
-					}
-					locations = append(locations, l)
-				}
-
-				// Add our list of generated locations to the nginx backend. These have been verified
-				// as having a backend so this is a safe operation.
-				if len(locations) > 0 {
-					servers[r.Host] = locations
-				}
+	// Controller loop.
+	for {
+		select {
+		case <-ticks:
+		case <-resync:
+			fmt.Println("Resyncing services and reloading Nginx")
+
+			err := c.Resync()
+			if err != nil {
+				fmt.Println(err)
 			}
 		}
 
-		// Add the upstreams and servers to the nginx configuration.
-		nginx.SetServers(servers)
-		nginx.SetUpstreams(upstreams)
-
-		err = nginx.Reload()
+		err := c.Sync()
 		if err != nil {
 			fmt.Println(err)
 			continue
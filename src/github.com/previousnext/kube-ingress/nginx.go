@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	"os"
+	"io"
+	"io/ioutil"
 	"reflect"
+	"sync"
 	"text/template"
+	"time"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -17,57 +24,101 @@ http {
     real_ip_header    X-Forwarded-For;
     set_real_ip_from  0.0.0.0/0;
     real_ip_recursive on;
+{{- range $directive := .Directives }}
+    {{ $directive }};
+{{- end }}
 
-{{ range $ud, $addresses := .New.Upstreams }}
-    upstream {{ $ud }} {
+{{ if .Include }}
+    include {{ .Include }}/upstream-*.conf;
+    include {{ .Include }}/server-*.conf;
+{{ else }}
+{{ range $fragment := .Upstreams }}{{ $fragment }}{{ end }}
+{{ range $fragment := .Servers }}{{ $fragment }}{{ end }}
+{{ end }}
+}
+{{ define "upstream" }}
+    upstream {{ .Name }} {
         ip_hash;
-{{ range $ad, $address := $addresses }}
+{{ range $ad, $address := .Addresses }}
         server {{ $address }};
 {{ end }}
     }
 {{ end }}
-
-{{ range $sd, $servers := .New.Servers }}
+{{ define "server" }}
     server {
-        listen      {{ $.Port }};
-        server_name {{ $sd }};
-        proxy_set_header Host $host;
-        proxy_set_header X-Real-IP $remote_addr;
-        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
-        proxy_set_header X-Forwarded-Proto $scheme;
-
-{{ range $ld, $location := $servers }}
+        listen      {{ .Port }};
+        server_name {{ .Name }};
+{{- range $directive := .Directives }}
+        {{ $directive }};
+{{- end }}
+
+{{ range $ld, $location := .Locations }}
         location {{ $location.Path }} {
             proxy_pass http://{{ $location.Upstream }};
+            proxy_set_header Host $host;
+            proxy_set_header X-Real-IP $remote_addr;
+            proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+            proxy_set_header X-Forwarded-Proto $scheme;
+{{- range $dd, $directive := $location.Directives }}
+            {{ $directive }};
+{{- end }}
         }
 {{ end }}
     }
-{{ end }}
-}`
+{{ end }}`
+)
+
+var (
+	reloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_ingress_reloads_total",
+		Help: "How many times Nginx has been reloaded, by result.",
+	}, []string{"result"})
+
+	reloadDuration = prometheus.NewSummary(prometheus.SummaryOpts{
+		Name: "kube_ingress_reload_duration_seconds",
+		Help: "How long successful Nginx reloads took.",
+	})
 )
 
-type Location struct {
-	Path     string
-	Upstream string
+// Returned by Reload when the configuration is the same as the last one reloaded.
+var errNotChanged = errors.New("Configuration has not changed. Not reloading the nginx daemon.")
+
+func init() {
+	prometheus.MustRegister(reloads)
+	prometheus.MustRegister(reloadDuration)
 }
 
-type Backend struct {
-	Servers   map[string][]Location
-	Upstreams map[string][]string
+// Rendered configuration for each server and upstream, keyed by name.
+type Fragments struct {
+	Servers   map[string]string
+	Upstreams map[string]string
 }
 
 type Nginx struct {
 	Template *template.Template
 	Port     string
 
+	// Once the configuration grows larger than ShardSize bytes the servers and
+	// upstreams are written to their own files in ShardDir. Zero disables sharding.
+	ShardDir  string
+	ShardSize int
+
 	// New configuration to be compared with against the private values.
-	New Backend
+	New routing.Backend
 
 	// The previously reloaded values.
-	Prev Backend
+	Prev routing.Backend
+
+	// The rendered fragments of the previously reloaded values. These get reused
+	// when a server or upstream has not changed.
+	Fragments Fragments
+
+	// The dump of the configuration from the last successful reload, see Applied.
+	appliedLock sync.RWMutex
+	applied     string
 }
 
-func (n *Nginx) SetServers(l map[string][]Location) {
+func (n *Nginx) SetServers(l map[string][]routing.Location) {
 	n.New.Servers = l
 }
 
@@ -75,34 +126,170 @@ func (n *Nginx) SetUpstreams(l map[string][]string) {
 	n.New.Upstreams = l
 }
 
+func (n *Nginx) SetDirectives(l []string) {
+	n.New.Directives = l
+}
+
+func (n *Nginx) SetServerDirectives(l map[string][]string) {
+	n.New.ServerDirectives = l
+}
+
 func (n *Nginx) Reload() error {
 	// Has the configuration changed? If it has we can reload.
-	if reflect.DeepEqual(n.New.Servers, n.Prev.Servers) && reflect.DeepEqual(n.New.Upstreams, n.Prev.Upstreams) {
-		return errors.New("Configuration has not changed. Not reloading the nginx daemon.")
+	if reflect.DeepEqual(n.New, n.Prev) {
+		return errNotChanged
+	}
+
+	// Only render the servers and upstreams which have changed.
+	f, err := n.Render()
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to render template %v\n", err))
+	}
+
+	// Large configurations are split up so Nginx only has to load them via an include.
+	if n.Sharded(f) {
+		err := n.WriteShards(f)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Build a new configuration.
-	if w, err := os.Create(*cliCfg); err != nil {
-		return errors.New(fmt.Sprintf("Failed to open %v: %v\n", tpl, err))
-	} else if err := n.Template.Execute(w, n); err != nil {
-		return errors.New(fmt.Sprintf("Failed to write template %v\n", err))
+	var cfg bytes.Buffer
+	err = n.Write(&cfg, f)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(*cliCfg, cfg.Bytes(), 0644)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to write %v: %v\n", *cliCfg, err))
 	}
 
 	// Reload the active daemon.
-	err := shellOut("nginx -s reload")
+	start := time.Now()
+	err = shellOut("nginx -s reload")
 	if err != nil {
+		reloads.WithLabelValues("failure").Inc()
 		return err
 	}
+	reloads.WithLabelValues("success").Inc()
+	reloadDuration.Observe(time.Since(start).Seconds())
 
 	// Set the previous values so Nginx doesn't continue to restart.
-	n.Prev.Servers = n.New.Servers
-	n.Prev.Upstreams = n.New.Upstreams
+	n.Prev = n.New
+	n.Fragments = f
+
+	// Keep what Nginx is now running, the files may be replaced by a reload which fails.
+	includes := make(map[string]string)
+	if n.Sharded(f) {
+		includes = n.Shards(f)
+	}
+	n.appliedLock.Lock()
+	n.applied = formatDump(*cliCfg, cfg.String(), includes)
+	n.appliedLock.Unlock()
 
 	return nil
 }
 
+// The configuration Nginx was last reloaded with, including any include files, with
+// credentials redacted. Returns false if Nginx has not been reloaded yet.
+func (n *Nginx) Applied() (string, bool) {
+	n.appliedLock.RLock()
+	defer n.appliedLock.RUnlock()
+	return n.applied, n.applied != ""
+}
+
+// Forget what was last reloaded so the next Reload renders everything again and
+// reloads Nginx, even if the configuration has not changed.
+func (n *Nginx) ForceReload() {
+	n.Prev = routing.Backend{}
+	n.Fragments = Fragments{}
+}
+
+// Write the configuration for a set of fragments. Large configurations include the
+// shard directory instead of the fragments, see WriteShards.
+func (n *Nginx) Write(w io.Writer, f Fragments) error {
+	data := struct {
+		Include    string
+		Directives []string
+		Servers    []string
+		Upstreams  []string
+	}{
+		Directives: n.New.Directives,
+		Servers:    sortedValues(f.Servers),
+		Upstreams:  sortedValues(f.Upstreams),
+	}
+
+	if n.Sharded(f) {
+		data.Include = n.ShardDir
+	}
+
+	err := n.Template.Execute(w, data)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to write template %v\n", err))
+	}
+	return nil
+}
+
+// Render the fragments for the new configuration. Fragments are only rendered when
+// their values differ from the previously reloaded values.
+func (n *Nginx) Render() (Fragments, error) {
+	f := Fragments{
+		Servers:   make(map[string]string),
+		Upstreams: make(map[string]string),
+	}
+
+	for name, locations := range n.New.Servers {
+		directives := n.New.ServerDirectives[name]
+		if prev, ok := n.Fragments.Servers[name]; ok && reflect.DeepEqual(locations, n.Prev.Servers[name]) && reflect.DeepEqual(directives, n.Prev.ServerDirectives[name]) {
+			f.Servers[name] = prev
+			continue
+		}
+
+		var b bytes.Buffer
+		err := n.Template.ExecuteTemplate(&b, "server", struct {
+			Name       string
+			Port       string
+			Directives []string
+			Locations  []routing.Location
+		}{
+			Name:       name,
+			Port:       n.Port,
+			Directives: directives,
+			Locations:  locations,
+		})
+		if err != nil {
+			return f, err
+		}
+		f.Servers[name] = b.String()
+	}
+
+	for name, addresses := range n.New.Upstreams {
+		if prev, ok := n.Fragments.Upstreams[name]; ok && reflect.DeepEqual(addresses, n.Prev.Upstreams[name]) {
+			f.Upstreams[name] = prev
+			continue
+		}
+
+		var b bytes.Buffer
+		err := n.Template.ExecuteTemplate(&b, "upstream", struct {
+			Name      string
+			Addresses []string
+		}{
+			Name:      name,
+			Addresses: addresses,
+		})
+		if err != nil {
+			return f, err
+		}
+		f.Upstreams[name] = b.String()
+	}
+
+	return f, nil
+}
+
 // Standard method for loading a Nginx configuration.
-func NewNginx(p string) (*Nginx, error) {
+func NewNginx(p, shardDir string, shardSize int) (*Nginx, error) {
 	// The template which will get used to expose Ingresses.
 	tmpl, err := template.New("nginx").Parse(tpl)
 	if err != nil {
@@ -111,15 +298,23 @@ func NewNginx(p string) (*Nginx, error) {
 
 	// Return the object so we can act upon it.
 	return &Nginx{
-		Template: tmpl,
-		Port:     p,
-		New: Backend{
-			Servers:   make(map[string][]Location),
-			Upstreams: make(map[string][]string),
+		Template:  tmpl,
+		Port:      p,
+		ShardDir:  shardDir,
+		ShardSize: shardSize,
+		New: routing.Backend{
+			Servers:          make(map[string][]routing.Location),
+			Upstreams:        make(map[string][]string),
+			ServerDirectives: make(map[string][]string),
+		},
+		Prev: routing.Backend{
+			Servers:          make(map[string][]routing.Location),
+			Upstreams:        make(map[string][]string),
+			ServerDirectives: make(map[string][]string),
 		},
-		Prev: Backend{
-			Servers:   make(map[string][]Location),
-			Upstreams: make(map[string][]string),
+		Fragments: Fragments{
+			Servers:   make(map[string]string),
+			Upstreams: make(map[string]string),
 		},
 	}, nil
 }
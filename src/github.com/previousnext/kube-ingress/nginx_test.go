@@ -1,20 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/previousnext/kube-ingress/routing"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestReload(t *testing.T) {
-	b := Backend{
-		Servers: map[string][]Location{
-			"server1": []Location{
-				Location{
+	b := routing.Backend{
+		Servers: map[string][]routing.Location{
+			"server1": []routing.Location{
+				routing.Location{
 					Path:     "/v1",
 					Upstream: "foo",
 				},
-				Location{
+				routing.Location{
 					Path:     "/v2",
 					Upstream: "bar",
 				},
@@ -37,4 +42,182 @@ func TestReload(t *testing.T) {
 	}
 	err := n.Reload()
 	assert.Equal(t, "Configuration has not changed. Not reloading the nginx daemon.", err.Error(), "Don't need to restart nginx")
+
+	fake, err := newFakeNginx()
+	assert.Nil(t, err)
+	defer fake.Close()
+
+	tmpl, err := NewNginx("80", "", 0)
+	assert.Nil(t, err)
+	n.Template = tmpl.Template
+	n.SetServerDirectives(map[string][]string{
+		"server1": []string{"add_header X-Frame-Options DENY"},
+	})
+	assert.Nil(t, n.Reload(), "A change to the directives alone is reloaded")
+
+	cfg, err := ioutil.ReadFile(*cliCfg)
+	assert.Nil(t, err)
+	assert.Contains(t, string(cfg), "add_header X-Frame-Options DENY;")
+	assert.NotNil(t, n.Reload(), "The directives are remembered after a reload")
+}
+
+// Stands in for the nginx binary and the configuration file, so Reload can be run in
+// tests. Reloads succeed until Fail is called.
+type fakeNginx struct {
+	Dir string
+
+	path string
+	cfg  string
+}
+
+// Make the following reloads fail, or succeed again.
+func (f *fakeNginx) Fail(fail bool) error {
+	script := "#!/bin/sh\n"
+	if fail {
+		script += "echo 'nginx: [emerg] invalid configuration' >&2\nexit 1\n"
+	}
+	return ioutil.WriteFile(filepath.Join(f.Dir, "bin", "nginx"), []byte(script), 0755)
+}
+
+// Put back the PATH and configuration file, and remove the directory.
+func (f *fakeNginx) Close() {
+	os.Setenv("PATH", f.path)
+	*cliCfg = f.cfg
+	os.RemoveAll(f.Dir)
+}
+
+func newFakeNginx() (*fakeNginx, error) {
+	dir, err := ioutil.TempDir("", "kube-ingress")
+	if err != nil {
+		return nil, err
+	}
+
+	f := &fakeNginx{
+		Dir:  dir,
+		path: os.Getenv("PATH"),
+		cfg:  *cliCfg,
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, "bin"), 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = f.Fail(false)
+	if err != nil {
+		return nil, err
+	}
+
+	os.Setenv("PATH", filepath.Join(dir, "bin")+string(os.PathListSeparator)+f.path)
+	*cliCfg = filepath.Join(dir, "nginx.conf")
+	return f, nil
+}
+
+func TestReloadSharded(t *testing.T) {
+	fake, err := newFakeNginx()
+	assert.Nil(t, err)
+	defer fake.Close()
+	dir := fake.Dir
+
+	shardDir := filepath.Join(dir, "shards")
+	n, err := NewNginx("80", shardDir, 1)
+	assert.Nil(t, err)
+
+	n.SetServers(map[string][]routing.Location{
+		"server1": []routing.Location{
+			routing.Location{
+				Path:     "/",
+				Upstream: "foo",
+			},
+		},
+	})
+	n.SetUpstreams(map[string][]string{
+		"foo": []string{
+			"1.2.3.4",
+		},
+	})
+	err = n.Reload()
+	assert.Nil(t, err)
+
+	cfg, err := ioutil.ReadFile(*cliCfg)
+	assert.Nil(t, err)
+	assert.Contains(t, string(cfg), "include "+shardDir+"/server-*.conf;", "Large configurations include the shards")
+	assert.NotContains(t, string(cfg), "server_name server1;")
+
+	server, err := ioutil.ReadFile(filepath.Join(shardDir, "server-server1.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(server), "server_name server1;")
+}
+
+func TestRender(t *testing.T) {
+	n, err := NewNginx("80", "", 0)
+	assert.Nil(t, err)
+
+	n.Prev = routing.Backend{
+		Servers: map[string][]routing.Location{
+			"server1": []routing.Location{
+				routing.Location{
+					Path:     "/",
+					Upstream: "foo",
+				},
+			},
+		},
+		Upstreams: map[string][]string{
+			"foo": []string{
+				"1.2.3.4",
+			},
+		},
+	}
+	n.Fragments = Fragments{
+		Servers: map[string]string{
+			"server1": "cached server1",
+		},
+		Upstreams: map[string]string{
+			"foo": "cached foo",
+		},
+	}
+
+	// The server is unchanged while the upstream has a new address.
+	n.SetServers(n.Prev.Servers)
+	n.SetUpstreams(map[string][]string{
+		"foo": []string{
+			"1.2.3.4",
+			"1.2.3.5",
+		},
+	})
+
+	f, err := n.Render()
+	assert.Nil(t, err)
+	assert.Equal(t, "cached server1", f.Servers["server1"], "Unchanged servers are not rendered again")
+	assert.Contains(t, f.Upstreams["foo"], "server 1.2.3.5;", "Changed upstreams are rendered again")
+}
+
+func TestRenderDirectives(t *testing.T) {
+	n, err := NewNginx("80", "", 0)
+	assert.Nil(t, err)
+
+	servers := map[string][]routing.Location{
+		"server1": []routing.Location{
+			routing.Location{
+				Path:     "/",
+				Upstream: "foo",
+			},
+		},
+	}
+	n.Prev.Servers = servers
+	n.Fragments.Servers["server1"] = "cached server1"
+
+	n.SetServers(servers)
+	n.SetDirectives([]string{"client_max_body_size 10m"})
+	n.SetServerDirectives(map[string][]string{
+		"server1": []string{"add_header X-Frame-Options DENY"},
+	})
+
+	f, err := n.Render()
+	assert.Nil(t, err)
+	assert.Contains(t, f.Servers["server1"], "        server_name server1;\n        add_header X-Frame-Options DENY;\n", "Servers are rendered again when their directives change")
+
+	var b bytes.Buffer
+	err = n.Write(&b, f)
+	assert.Nil(t, err)
+	assert.Contains(t, b.String(), "    real_ip_recursive on;\n    client_max_body_size 10m;\n", "Directives are added to the http block")
 }
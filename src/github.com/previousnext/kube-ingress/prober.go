@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	probeSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_ingress_probe_success",
+		Help: "Whether the last synthetic request for a host and path succeeded.",
+	}, []string{"host", "path"})
+
+	probeDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_ingress_probe_duration_seconds",
+		Help: "How long the last synthetic request for a host and path took.",
+	}, []string{"host", "path"})
+)
+
+func init() {
+	prometheus.MustRegister(probeSuccess)
+	prometheus.MustRegister(probeDuration)
+}
+
+type Prober struct {
+	// Address of the local Nginx which the requests will be sent through.
+	Addr     string
+	Client   *http.Client
+	Interval time.Duration
+
+	// How many requests to send at the same time, so a few hanging backends don't
+	// hold up the rest of the round.
+	Workers int
+
+	lock    sync.Mutex
+	servers map[string][]routing.Location
+	onRound func(started time.Time, healthy bool)
+	stop    chan struct{}
+}
+
+// Set the servers which are currently being served by Nginx.
+func (p *Prober) SetServers(s map[string][]routing.Location) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.servers = s
+}
+
+// Set a function to call after each round with when the round started and whether
+// every probe in it succeeded.
+func (p *Prober) OnRound(f func(started time.Time, healthy bool)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.onRound = f
+}
+
+// Probe every route on each interval until Stop is called.
+func (p *Prober) Start() {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.Round()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Stop probing.
+func (p *Prober) Stop() {
+	close(p.stop)
+}
+
+// Probe every route once and replace the metrics with the results.
+func (p *Prober) Round() {
+	started := time.Now()
+
+	p.lock.Lock()
+	servers := p.servers
+	onRound := p.onRound
+	p.lock.Unlock()
+
+	type route struct {
+		host, path string
+	}
+	type result struct {
+		route
+		success  float64
+		duration time.Duration
+	}
+
+	var (
+		results []result
+		lock    sync.Mutex
+		wg      sync.WaitGroup
+		queue   = make(chan route)
+	)
+
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range queue {
+				start := time.Now()
+				err := p.Probe(r.host, r.path)
+				res := result{
+					route:    r,
+					duration: time.Since(start),
+				}
+				if err != nil {
+					fmt.Printf("Probe failed for %s%s: %v\n", r.host, r.path, err)
+				} else {
+					res.success = 1
+				}
+
+				lock.Lock()
+				results = append(results, res)
+				lock.Unlock()
+			}
+		}()
+	}
+	for host, locations := range servers {
+		for _, l := range locations {
+			queue <- route{host, l.Path}
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	// Start from a clean slate so routes which have been removed don't linger.
+	probeSuccess.Reset()
+	probeDuration.Reset()
+	healthy := len(results) > 0
+	for _, r := range results {
+		probeSuccess.WithLabelValues(r.host, r.path).Set(r.success)
+		probeDuration.WithLabelValues(r.host, r.path).Set(r.duration.Seconds())
+		if r.success <= 0 {
+			healthy = false
+		}
+	}
+
+	if onRound != nil {
+		onRound(started, healthy)
+	}
+}
+
+// Send a single request for the host and path through Nginx. A 5xx response means
+// Nginx could not route the request to a working backend.
+func (p *Prober) Probe(host, path string) error {
+	if path == "" {
+		path = "/"
+	}
+
+	req, err := http.NewRequest("GET", "http://"+p.Addr+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = host
+	req.Header.Set("User-Agent", "kube-ingress-prober")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return errors.New(fmt.Sprintf("Received status code %d", resp.StatusCode))
+	}
+	return nil
+}
+
+// Standard method for loading a Prober object. The interval must be positive.
+func NewProber(addr string, interval time.Duration, workers int) *Prober {
+	p := &Prober{
+		Addr: addr,
+		Client: &http.Client{
+			Timeout: 5 * time.Second,
+			// A redirect is a valid response, we don't want to follow it off the cluster.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Interval: interval,
+		Workers:  workers,
+		servers:  make(map[string][]routing.Location),
+		stop:     make(chan struct{}),
+	}
+
+	// Start sending requests through Nginx for the servers it is serving.
+	go p.Start()
+
+	return p
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/previousnext/kube-ingress/routing"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbe(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "broken.example.com" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	p := &Prober{
+		Addr:   strings.TrimPrefix(ts.URL, "http://"),
+		Client: http.DefaultClient,
+	}
+
+	assert.Nil(t, p.Probe("working.example.com", "/v1"), "A 404 is still a working route")
+	assert.NotNil(t, p.Probe("broken.example.com", "/v1"), "A 502 means the backend could not be reached")
+}
+
+func TestRound(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "hanging.example.com" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	p := NewProber(strings.TrimPrefix(ts.URL, "http://"), time.Hour, 4)
+	defer p.Stop()
+
+	p.SetServers(map[string][]routing.Location{
+		"hanging.example.com": []routing.Location{
+			routing.Location{Path: "/a"},
+			routing.Location{Path: "/b"},
+			routing.Location{Path: "/c"},
+			routing.Location{Path: "/d"},
+		},
+	})
+
+	var healthy bool
+	p.OnRound(func(started time.Time, h bool) {
+		healthy = h
+	})
+
+	start := time.Now()
+	p.Round()
+	assert.True(t, time.Since(start) < 600*time.Millisecond, "Routes are probed at the same time")
+
+	var m dto.Metric
+	err := probeSuccess.WithLabelValues("hanging.example.com", "/d").Write(&m)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(1), m.GetGauge().GetValue())
+	assert.True(t, healthy, "Every probe in the round succeeded")
+}
@@ -0,0 +1,162 @@
+package routing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+// An Annotation turns the value of an Ingress annotation into Nginx directives which
+// are added to every location built for that Ingress. Downstream builds can add their
+// own by calling RegisterAnnotation from an init function, or register them with
+// their own Router.
+//
+// Annotations only add location directives, a Contributor adds to the server and
+// http blocks. The controller sets proxy_pass and the Host, X-Real-IP,
+// X-Forwarded-For and X-Forwarded-Proto headers in every location, because a
+// proxy_set_header in a location stops Nginx inheriting them from the server.
+// Annotations can't set those again.
+type Annotation interface {
+	// The annotation key this parser is responsible for, eg. "example.com/timeout".
+	Key() string
+
+	// Parse the annotation value into directives, without the trailing semicolon.
+	Parse(value string) ([]string, error)
+}
+
+type registeredAnnotation struct {
+	Annotation
+	Priority int
+}
+
+// Directives which can be given once for each header they set.
+var headerDirectives = map[string]bool{
+	"add_header":         true,
+	"proxy_set_header":   true,
+	"proxy_hide_header":  true,
+	"more_set_headers":   true,
+	"more_clear_headers": true,
+}
+
+// Directives the controller sets on every location, see Annotation.
+var reservedDirectives = []string{
+	"proxy_pass",
+	"proxy_set_header host",
+	"proxy_set_header x-real-ip",
+	"proxy_set_header x-forwarded-for",
+	"proxy_set_header x-forwarded-proto",
+}
+
+// Register a parser for an annotation with DefaultRouter.
+func RegisterAnnotation(priority int, a Annotation) {
+	DefaultRouter.RegisterAnnotation(priority, a)
+}
+
+// Register a parser for an annotation. Parsers are applied in order of priority,
+// lowest first, and when two parsers produce the same directive the first one wins.
+// Directives such as proxy_set_header which set a header only conflict when they
+// are for the same header. Registering a second parser for a key panics, the same as
+// registering a duplicate metric.
+func (rt *Router) RegisterAnnotation(priority int, a Annotation) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	for _, r := range rt.annotations {
+		if r.Key() == a.Key() {
+			panic(fmt.Sprintf("An annotation parser is already registered for %s", a.Key()))
+		}
+	}
+
+	rt.annotations = append(rt.annotations, registeredAnnotation{
+		Annotation: a,
+		Priority:   priority,
+	})
+	sort.SliceStable(rt.annotations, func(i, j int) bool {
+		return rt.annotations[i].Priority < rt.annotations[j].Priority
+	})
+}
+
+// Whether a parser has been registered with DefaultRouter, see Router.AnnotationRegistered.
+func AnnotationRegistered(namespace, key string) (registered, allowed bool) {
+	return DefaultRouter.AnnotationRegistered(namespace, key)
+}
+
+// Whether a parser has been registered for an annotation key, and if so whether
+// the policy allows it in the namespace.
+func (rt *Router) AnnotationRegistered(namespace, key string) (registered, allowed bool) {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+
+	for _, r := range rt.annotations {
+		if r.Key() == key {
+			return true, rt.policy.Allowed(namespace, r.Annotation)
+		}
+	}
+	return false, false
+}
+
+// Build the directives for an Ingress with DefaultRouter.
+func Directives(ing extensions.Ingress) []string {
+	return DefaultRouter.Directives(ing)
+}
+
+// Build the directives for an Ingress from its annotations. Annotations which are not
+// allowed by the policy, fail to parse or conflict with an earlier parser are skipped.
+func (rt *Router) Directives(ing extensions.Ingress) []string {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+	return rt.directives(ing)
+}
+
+func (rt *Router) directives(ing extensions.Ingress) []string {
+	set := newDirectiveSet(reservedDirectives)
+
+	for _, r := range rt.annotations {
+		value, ok := ing.ObjectMeta.Annotations[r.Key()]
+		if !ok {
+			continue
+		}
+
+		if !rt.policy.Allowed(ing.ObjectMeta.Namespace, r.Annotation) {
+			rt.logf("Skipping annotation %s on %s/%s: not allowed in this namespace", r.Key(), ing.ObjectMeta.Namespace, ing.ObjectMeta.Name)
+			continue
+		}
+
+		ds, err := r.Parse(value)
+		if err != nil {
+			rt.logf("Skipping annotation %s on %s/%s: %v", r.Key(), ing.ObjectMeta.Namespace, ing.ObjectMeta.Name, err)
+			continue
+		}
+
+		for _, d := range ds {
+			if name, owner := set.add(r.Key(), d); owner != "" {
+				rt.logf("Skipping %s from %s on %s/%s: already set by %s", name, r.Key(), ing.ObjectMeta.Namespace, ing.ObjectMeta.Name, owner)
+			}
+		}
+	}
+
+	return set.directives
+}
+
+// The name a directive conflicts on: the directive, plus the lower cased header for
+// directives which set headers.
+func directiveKey(fields []string) string {
+	name := fields[0]
+	if !headerDirectives[name] {
+		return name
+	}
+
+	// The more_*_headers directives take -s and -t options before the header.
+	args := fields[1:]
+	for len(args) > 1 && (args[0] == "-s" || args[0] == "-t") {
+		args = args[2:]
+	}
+	if len(args) <= 0 {
+		return name
+	}
+
+	header := strings.SplitN(strings.Trim(args[0], `"'`), ":", 2)[0]
+	return name + " " + strings.ToLower(header)
+}
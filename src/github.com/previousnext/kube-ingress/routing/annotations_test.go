@@ -0,0 +1,86 @@
+package routing_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/previousnext/kube-ingress/routing/routingtest"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+type testAnnotation struct {
+	key        string
+	directives []string
+}
+
+func (a testAnnotation) Key() string {
+	return a.key
+}
+
+func (a testAnnotation) Parse(value string) ([]string, error) {
+	if value == "invalid" {
+		return nil, errors.New("Invalid value")
+	}
+	return a.directives, nil
+}
+
+func TestDirectives(t *testing.T) {
+	rt := routing.NewRouter()
+
+	rt.RegisterAnnotation(20, testAnnotation{
+		key:        "example.com/late",
+		directives: []string{"proxy_read_timeout 10s", "proxy_buffering off"},
+	})
+	rt.RegisterAnnotation(10, testAnnotation{
+		key:        "example.com/early",
+		directives: []string{"proxy_read_timeout 60s"},
+	})
+	rt.RegisterAnnotation(30, testAnnotation{
+		key:        "example.com/broken",
+		directives: []string{"client_max_body_size 1m"},
+	})
+	rt.RegisterAnnotation(40, testAnnotation{
+		key:        "example.com/header-a",
+		directives: []string{"proxy_set_header X-A a", "more_set_headers -s 404 'X-Team: a'"},
+	})
+	rt.RegisterAnnotation(50, testAnnotation{
+		key:        "example.com/header-b",
+		directives: []string{"proxy_set_header X-B b", "proxy_set_header x-a b", "more_set_headers 'X-Team: b'", "proxy_set_header Host example.com", "proxy_pass http://example.com"},
+	})
+
+	assert.Panics(t, func() {
+		rt.RegisterAnnotation(0, testAnnotation{key: "example.com/early"})
+	}, "Only one parser per annotation")
+
+	ings := []extensions.Ingress{
+		routingtest.Ingress("ns0", "svc0", "svc0.example.com", map[string]string{"/": "svc0"}),
+	}
+	svcs := routingtest.Endpoints{
+		"ns0-svc0": []string{"10.0.0.0:80"},
+	}
+	ings[0].ObjectMeta.Annotations = map[string]string{
+		"example.com/late":   "",
+		"example.com/early":  "",
+		"example.com/broken": "invalid",
+	}
+
+	assert.Equal(t, []string{
+		"proxy_read_timeout 60s",
+		"proxy_buffering off",
+	}, rt.Directives(ings[0]), "Lower priorities win conflicts and invalid values are skipped")
+
+	ings[0].ObjectMeta.Annotations["example.com/header-a"] = ""
+	ings[0].ObjectMeta.Annotations["example.com/header-b"] = ""
+	assert.Equal(t, []string{
+		"proxy_read_timeout 60s",
+		"proxy_buffering off",
+		"proxy_set_header X-A a",
+		"more_set_headers -s 404 'X-Team: a'",
+		"proxy_set_header X-B b",
+	}, rt.Directives(ings[0]), "Headers only conflict with the same header, and the controller's proxy_pass and headers can't be set again")
+
+	b := rt.Build(ings, svcs)
+	assert.Equal(t, rt.Directives(ings[0]), b.Servers["svc0.example.com"][0].Directives, "Directives are added to each location")
+}
@@ -0,0 +1,154 @@
+package routing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+// A Contributor adds Nginx directives to the http block, or to the server block of
+// each host, which annotations can't reach. Downstream builds can add their own by
+// calling RegisterContributor from an init function, or register them with their
+// own Router.
+//
+// The controller sets listen and server_name in every server, and the real_ip
+// directives in the http block. Contributors can't set those again.
+type Contributor interface {
+	// A name for the contributor, used when logging skipped directives.
+	Name() string
+
+	// The directives for the http block, built from every Ingress. Directives don't
+	// have the trailing semicolon.
+	HTTP(ings []extensions.Ingress) ([]string, error)
+
+	// The directives for the server block of a host, built from the Ingress which
+	// the host's locations come from.
+	Server(host string, ing extensions.Ingress) ([]string, error)
+}
+
+type registeredContributor struct {
+	Contributor
+	Priority int
+}
+
+// Directives the controller sets in every server block, see Contributor.
+var reservedServerDirectives = []string{
+	"listen",
+	"server_name",
+}
+
+// Directives the controller sets in the http block, see Contributor.
+var reservedHTTPDirectives = []string{
+	"real_ip_header",
+	"set_real_ip_from",
+	"real_ip_recursive",
+}
+
+// Register a contributor with DefaultRouter.
+func RegisterContributor(priority int, c Contributor) {
+	DefaultRouter.RegisterContributor(priority, c)
+}
+
+// Register a contributor. Contributors are applied in order of priority, lowest
+// first, and conflicts are settled the same way as for annotations: the first
+// contributor to produce a directive wins. Registering a second contributor with
+// the same name panics.
+func (rt *Router) RegisterContributor(priority int, c Contributor) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	for _, r := range rt.contributors {
+		if r.Name() == c.Name() {
+			panic(fmt.Sprintf("A contributor is already registered as %s", c.Name()))
+		}
+	}
+
+	rt.contributors = append(rt.contributors, registeredContributor{
+		Contributor: c,
+		Priority:    priority,
+	})
+	sort.SliceStable(rt.contributors, func(i, j int) bool {
+		return rt.contributors[i].Priority < rt.contributors[j].Priority
+	})
+}
+
+// Build the http block directives from the contributors. Contributors which fail
+// are skipped.
+func (rt *Router) httpDirectives(ings []extensions.Ingress) []string {
+	set := newDirectiveSet(reservedHTTPDirectives)
+
+	for _, r := range rt.contributors {
+		ds, err := r.HTTP(ings)
+		if err != nil {
+			rt.logf("Skipping http directives from %s: %v", r.Name(), err)
+			continue
+		}
+
+		for _, d := range ds {
+			if name, owner := set.add(r.Name(), d); owner != "" {
+				rt.logf("Skipping %s from %s in the http block: already set by %s", name, r.Name(), owner)
+			}
+		}
+	}
+
+	return set.directives
+}
+
+// Build the server block directives for a host from the contributors. Contributors
+// which fail are skipped.
+func (rt *Router) serverDirectives(host string, ing extensions.Ingress) []string {
+	set := newDirectiveSet(reservedServerDirectives)
+
+	for _, r := range rt.contributors {
+		ds, err := r.Server(host, ing)
+		if err != nil {
+			rt.logf("Skipping server directives from %s for %s: %v", r.Name(), host, err)
+			continue
+		}
+
+		for _, d := range ds {
+			if name, owner := set.add(r.Name(), d); owner != "" {
+				rt.logf("Skipping %s from %s for %s: already set by %s", name, r.Name(), host, owner)
+			}
+		}
+	}
+
+	return set.directives
+}
+
+// Directives in the order they were added, with the owner of each directive name so
+// later conflicting directives can be skipped.
+type directiveSet struct {
+	directives []string
+	owners     map[string]string
+}
+
+// Add a directive unless its name already has an owner, see directiveKey. Returns
+// the name and its owner when the directive is skipped.
+func (s *directiveSet) add(owner, d string) (name, existing string) {
+	fields := strings.Fields(d)
+	if len(fields) <= 0 {
+		return "", ""
+	}
+
+	name = directiveKey(fields)
+	if existing, ok := s.owners[name]; ok {
+		return name, existing
+	}
+	s.owners[name] = owner
+	s.directives = append(s.directives, d)
+	return name, ""
+}
+
+// A set where the reserved directives are owned by the controller.
+func newDirectiveSet(reserved []string) *directiveSet {
+	s := &directiveSet{
+		owners: make(map[string]string),
+	}
+	for _, d := range reserved {
+		s.owners[d] = "kube-ingress"
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package routing_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/previousnext/kube-ingress/routing/routingtest"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+type testContributor struct {
+	name   string
+	http   []string
+	server []string
+	err    error
+}
+
+func (c testContributor) Name() string {
+	return c.name
+}
+
+func (c testContributor) HTTP(ings []extensions.Ingress) ([]string, error) {
+	return c.http, c.err
+}
+
+// Tags each server with the Ingress it was built from.
+func (c testContributor) Server(host string, ing extensions.Ingress) ([]string, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return append([]string{"set $ingress " + ing.ObjectMeta.Name}, c.server...), nil
+}
+
+func TestContributors(t *testing.T) {
+	rt := routing.NewRouter()
+
+	rt.RegisterContributor(20, testContributor{
+		name:   "late",
+		http:   []string{"client_max_body_size 10m", "gzip on"},
+		server: []string{"add_header X-Frame-Options DENY"},
+	})
+	rt.RegisterContributor(10, testContributor{
+		name:   "early",
+		http:   []string{"client_max_body_size 1m", "real_ip_header X-Real-IP"},
+		server: []string{"add_header x-frame-options SAMEORIGIN", "listen 8080", "server_name example.com"},
+	})
+	rt.RegisterContributor(30, testContributor{
+		name: "broken",
+		err:  errors.New("Failed"),
+	})
+
+	assert.Panics(t, func() {
+		rt.RegisterContributor(0, testContributor{name: "early"})
+	}, "Only one contributor per name")
+
+	ings := []extensions.Ingress{
+		routingtest.Ingress("ns0", "first", "svc0.example.com", map[string]string{"/": "svc0"}),
+		routingtest.Ingress("ns0", "second", "svc0.example.com", map[string]string{"/": "svc0"}),
+		routingtest.Ingress("ns0", "unused", "svc1.example.com", map[string]string{"/": "svc1"}),
+	}
+	svcs := routingtest.Endpoints{
+		"ns0-svc0": []string{"10.0.0.0:80"},
+	}
+
+	b := rt.Build(ings, svcs)
+	assert.Equal(t, []string{
+		"client_max_body_size 1m",
+		"gzip on",
+	}, b.Directives, "Lower priorities win conflicts and the controller's real_ip directives can't be set again")
+	assert.Equal(t, map[string][]string{
+		"svc0.example.com": []string{
+			"set $ingress second",
+			"add_header x-frame-options SAMEORIGIN",
+		},
+	}, b.ServerDirectives, "Server directives come from the Ingress which won the host, and listen and server_name can't be set again")
+}
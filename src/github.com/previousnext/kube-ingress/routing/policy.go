@@ -0,0 +1,61 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Annotations which are risky to let every tenant use, such as raw configuration
+// snippets, implement RestrictedAnnotation. They are only applied in namespaces
+// the AnnotationPolicy allows them in.
+type RestrictedAnnotation interface {
+	Annotation
+	Restricted() bool
+}
+
+// The restricted annotation keys each namespace may use. The "*" namespace applies
+// to every namespace.
+type AnnotationPolicy map[string]map[string]bool
+
+// Parse policy rules in the form "namespace=key1,key2".
+func ParseAnnotationPolicy(rules []string) (AnnotationPolicy, error) {
+	p := AnnotationPolicy{}
+
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return p, errors.New(fmt.Sprintf("Invalid annotation policy %q, expected namespace=key1,key2", rule))
+		}
+
+		if _, ok := p[parts[0]]; !ok {
+			p[parts[0]] = make(map[string]bool)
+		}
+		for _, key := range strings.Split(parts[1], ",") {
+			p[parts[0]][strings.TrimSpace(key)] = true
+		}
+	}
+
+	return p, nil
+}
+
+// Set the policy of DefaultRouter.
+func SetAnnotationPolicy(p AnnotationPolicy) {
+	DefaultRouter.SetAnnotationPolicy(p)
+}
+
+// Set the policy which Directives enforces for restricted annotations. Nothing
+// restricted is allowed until a policy is set.
+func (rt *Router) SetAnnotationPolicy(p AnnotationPolicy) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	rt.policy = p
+}
+
+// Whether an annotation may be used in a namespace under this policy.
+func (p AnnotationPolicy) Allowed(namespace string, a Annotation) bool {
+	if r, ok := a.(RestrictedAnnotation); !ok || !r.Restricted() {
+		return true
+	}
+	return p[namespace][a.Key()] || p["*"][a.Key()]
+}
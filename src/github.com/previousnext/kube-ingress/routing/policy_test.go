@@ -0,0 +1,55 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/previousnext/kube-ingress/routing/routingtest"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+type restrictedAnnotation struct {
+	testAnnotation
+}
+
+func (a restrictedAnnotation) Restricted() bool {
+	return true
+}
+
+func TestAnnotationPolicy(t *testing.T) {
+	rt := routing.NewRouter()
+
+	rt.RegisterAnnotation(0, restrictedAnnotation{testAnnotation{
+		key:        "example.com/snippet",
+		directives: []string{"more_set_headers X-Team: a"},
+	}})
+	rt.RegisterAnnotation(0, testAnnotation{
+		key:        "example.com/buffering",
+		directives: []string{"proxy_buffering off"},
+	})
+
+	ings := []extensions.Ingress{
+		routingtest.Ingress("ns0", "svc0", "svc0.example.com", map[string]string{"/": "svc0"}),
+		routingtest.Ingress("ns1", "svc1", "svc1.example.com", map[string]string{"/": "svc1"}),
+	}
+	for n := range ings {
+		ings[n].ObjectMeta.Annotations = map[string]string{
+			"example.com/snippet":   "",
+			"example.com/buffering": "",
+		}
+	}
+
+	assert.Equal(t, []string{"proxy_buffering off"}, rt.Directives(ings[0]), "Restricted annotations are not allowed by default")
+
+	_, err := routing.ParseAnnotationPolicy([]string{"ns0"})
+	assert.NotNil(t, err, "Rules need a list of annotations")
+
+	p, err := routing.ParseAnnotationPolicy([]string{"ns0=example.com/snippet"})
+	assert.Nil(t, err)
+	rt.SetAnnotationPolicy(p)
+
+	assert.Equal(t, []string{"more_set_headers X-Team: a", "proxy_buffering off"}, rt.Directives(ings[0]), "Allowed in ns0")
+	assert.Equal(t, []string{"proxy_buffering off"}, rt.Directives(ings[1]), "Still not allowed in ns1")
+	assert.Empty(t, routing.Directives(ings[0]), "Other routers have their own parsers and policy")
+}
@@ -0,0 +1,205 @@
+// Package routing turns Ingresses into the routing table kube-ingress serves: a set
+// of servers, each with locations pointing at upstreams of pod addresses. It holds
+// the same rules the controller uses so other tools can reuse them.
+//
+// A Router holds the annotation parsers, the contributors, the annotation policy and
+// the logger used while building. The package level functions use DefaultRouter, which is what the
+// controller and plugins registering from an init function use. Embedders which need
+// their own parsers or policy create a Router with NewRouter.
+package routing
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+type Location struct {
+	Path     string
+	Upstream string
+
+	// The Ingress the location was built from, as namespace/name.
+	Ingress string
+
+	// Added by the annotations on the Ingress.
+	Directives []string
+}
+
+// The routing table: locations keyed by host and pod addresses keyed by upstream.
+type Backend struct {
+	Servers   map[string][]Location
+	Upstreams map[string][]string
+
+	// Added to the http block, and to the server block of each host, by the
+	// contributors.
+	Directives       []string
+	ServerDirectives map[string][]string
+}
+
+// Endpoints looks up the pod addresses of a service by its upstream name, see
+// MergeNameNameSpace. An error means the service has no running pods.
+type Endpoints interface {
+	Get(name string) ([]string, error)
+}
+
+// A Logger is told about the paths and annotations which are left out of the routing
+// table, and why. Messages don't end with a newline.
+type Logger func(format string, args ...interface{})
+
+// A Router builds routing tables with its own annotation parsers, contributors,
+// annotation policy and logger.
+type Router struct {
+	lock         sync.RWMutex
+	annotations  []registeredAnnotation
+	contributors []registeredContributor
+	policy       AnnotationPolicy
+	logf         Logger
+}
+
+// The Router used by the package level functions.
+var DefaultRouter = NewRouter()
+
+// Set the Logger the Router reports skipped paths and annotations to. Messages are
+// discarded until one is set.
+func (rt *Router) SetLogger(l Logger) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	rt.logf = l
+}
+
+// Set the Logger of DefaultRouter.
+func SetLogger(l Logger) {
+	DefaultRouter.SetLogger(l)
+}
+
+// Build the servers and upstreams for a list of ingresses with DefaultRouter.
+func Build(ings []extensions.Ingress, svcs Endpoints) Backend {
+	return DefaultRouter.Build(ings, svcs)
+}
+
+// Build the servers and upstreams for a list of ingresses. Paths are only added
+// when their service has running pods, and rules without HTTP paths are skipped.
+// The server directives of a host come from the Ingress its locations come from.
+func (rt *Router) Build(ings []extensions.Ingress, svcs Endpoints) Backend {
+	rt.lock.RLock()
+	defer rt.lock.RUnlock()
+
+	var (
+		servers   = make(map[string][]Location)
+		upstreams = make(map[string][]string)
+		owners    = make(map[string]extensions.Ingress)
+	)
+
+	// Load up the pods for the service in this ingress.
+	for _, i := range ings {
+		directives := rt.directives(i)
+
+		// Build a our listeners based on the ingress rules.
+		for _, r := range i.Spec.Rules {
+			if r.HTTP == nil {
+				continue
+			}
+
+			var locations []Location
+
+			for _, pa := range r.HTTP.Paths {
+				name := MergeNameNameSpace(i.ObjectMeta.Namespace, pa.Backend.ServiceName)
+
+				// Get the list of backends from this rule.
+				list, err := svcs.Get(name)
+				if err != nil {
+					rt.logf("Failed to get service pods: %s", strings.TrimSpace(err.Error()))
+					continue
+				}
+
+				// We have a set of IPs so we are now free to add the upstream and location
+				// to our nginx configuration and be a part of the next reload.
+				upstreams[name] = list
+
+				// Add this to our list of paths to implement in Nginx.
+				l := Location{
+					Path:       pa.Path,
+					Upstream:   name,
+					Ingress:    i.ObjectMeta.Namespace + "/" + i.ObjectMeta.Name,
+					Directives: directives,
+				}
+				locations = append(locations, l)
+			}
+
+			// Add our list of generated locations to the nginx backend. These have been verified
+			// as having a backend so this is a safe operation.
+			if len(locations) > 0 {
+				servers[r.Host] = locations
+				owners[r.Host] = i
+			}
+		}
+	}
+
+	serverDirectives := make(map[string][]string)
+	for host, i := range owners {
+		if ds := rt.serverDirectives(host, i); len(ds) > 0 {
+			serverDirectives[host] = ds
+		}
+	}
+
+	return Backend{
+		Servers:          servers,
+		Upstreams:        upstreams,
+		Directives:       rt.httpDirectives(ings),
+		ServerDirectives: serverDirectives,
+	}
+}
+
+// The server Nginx answers with for hosts it has no server for: the first by name.
+func (b Backend) DefaultServer() (string, bool) {
+	var hosts []string
+	for name := range b.Servers {
+		hosts = append(hosts, name)
+	}
+	sort.Strings(hosts)
+
+	if len(hosts) <= 0 {
+		return "", false
+	}
+	return hosts[0], true
+}
+
+// Find the location a request is routed to: the server for the host, or the default
+// server when there isn't one, then the location with the longest matching prefix.
+func (b Backend) Match(host, path string) (Location, bool) {
+	locations, ok := b.Servers[host]
+	if !ok {
+		def, ok := b.DefaultServer()
+		if !ok {
+			return Location{}, false
+		}
+		locations = b.Servers[def]
+	}
+
+	var (
+		location Location
+		found    bool
+	)
+	for _, l := range locations {
+		if strings.HasPrefix(path, l.Path) && (!found || len(l.Path) > len(location.Path)) {
+			location = l
+			found = true
+		}
+	}
+	return location, found
+}
+
+// Standard method for loading a Router object.
+func NewRouter() *Router {
+	return &Router{
+		policy: AnnotationPolicy{},
+		logf:   func(string, ...interface{}) {},
+	}
+}
+
+// Helper to merge the name and namespace of a service.
+func MergeNameNameSpace(ns, n string) string {
+	return ns + "-" + n
+}
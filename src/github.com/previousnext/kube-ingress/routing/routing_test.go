@@ -0,0 +1,62 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/previousnext/kube-ingress/routing/routingtest"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+func TestBuild(t *testing.T) {
+	ings := []extensions.Ingress{
+		routingtest.Ingress("shop", "shop", "shop.example.com", map[string]string{
+			"/":    "web",
+			"/api": "api",
+		}),
+	}
+	svcs := routingtest.Endpoints{
+		"shop-web": []string{"10.0.0.1:80", "10.0.0.2:80"},
+	}
+
+	// A rule without HTTP paths is valid, it has nothing for us to route.
+	ings = append(ings, routingtest.Ingress("empty", "empty", "empty.example.com", nil))
+	ings[1].Spec.Rules[0].HTTP = nil
+
+	b := routing.Build(ings, svcs)
+	assert.Len(t, b.Servers, 1)
+	assert.Equal(t, []routing.Location{
+		routing.Location{
+			Path:     "/",
+			Upstream: "shop-web",
+			Ingress:  "shop/shop",
+		},
+	}, b.Servers["shop.example.com"], "Paths without running pods are skipped")
+	assert.Equal(t, svcs["shop-web"], b.Upstreams["shop-web"])
+}
+
+func TestMatch(t *testing.T) {
+	b := routing.Backend{
+		Servers: map[string][]routing.Location{
+			"b.example.com": []routing.Location{
+				routing.Location{Path: "/", Upstream: "web"},
+				routing.Location{Path: "/api", Upstream: "api"},
+			},
+			"a.example.com": []routing.Location{
+				routing.Location{Path: "/docs", Upstream: "docs"},
+			},
+		},
+	}
+
+	l, ok := b.Match("b.example.com", "/api/v1")
+	assert.True(t, ok)
+	assert.Equal(t, "api", l.Upstream, "The longest prefix wins")
+
+	l, ok = b.Match("unknown.example.com", "/docs/intro")
+	assert.True(t, ok)
+	assert.Equal(t, "docs", l.Upstream, "Unknown hosts go to the first server")
+
+	_, ok = b.Match("a.example.com", "/")
+	assert.False(t, ok, "No location matches")
+}
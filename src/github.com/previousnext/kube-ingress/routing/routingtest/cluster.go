@@ -0,0 +1,83 @@
+package routingtest
+
+import (
+	"fmt"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// Generate a cluster of ingresses which each route a host to their own service. The
+// ingress in namespace nsN routes svcN.example.com to the service svcN, which is
+// backed by the given number of endpoints.
+func Cluster(ingresses, endpoints int) ([]extensions.Ingress, Endpoints) {
+	var (
+		ings []extensions.Ingress
+		eps  = make(Endpoints)
+	)
+
+	for i := 0; i < ingresses; i++ {
+		ns := fmt.Sprintf("ns%d", i)
+		name := fmt.Sprintf("svc%d", i)
+
+		ings = append(ings, Ingress(ns, name, name+".example.com", map[string]string{
+			"/": name,
+		}))
+
+		var addrs []string
+		for e := 0; e < endpoints; e++ {
+			addrs = append(addrs, podIP(i, e)+":80")
+		}
+		eps[routing.MergeNameNameSpace(ns, name)] = addrs
+	}
+
+	return ings, eps
+}
+
+// The Ingresses, Services and running Pods of the cluster Cluster generates, for a
+// fake Kubernetes client to serve.
+func ClusterObjects(ingresses, endpoints int) []runtime.Object {
+	var objs []runtime.Object
+
+	ings, _ := Cluster(ingresses, endpoints)
+	for i := range ings {
+		ns := ings[i].ObjectMeta.Namespace
+		name := ings[i].ObjectMeta.Name
+		selector := map[string]string{
+			"app": name,
+		}
+
+		objs = append(objs, &ings[i], &api.Service{
+			ObjectMeta: api.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+			},
+			Spec: api.ServiceSpec{
+				Selector: selector,
+			},
+		})
+
+		for e := 0; e < endpoints; e++ {
+			objs = append(objs, &api.Pod{
+				ObjectMeta: api.ObjectMeta{
+					Name:      fmt.Sprintf("%s-%d", name, e),
+					Namespace: ns,
+					Labels:    selector,
+				},
+				Status: api.PodStatus{
+					Phase: api.PodRunning,
+					PodIP: podIP(i, e),
+				},
+			})
+		}
+	}
+
+	return objs
+}
+
+// The address of an endpoint of a generated service.
+func podIP(service, endpoint int) string {
+	return fmt.Sprintf("10.%d.%d.%d", service/256%256, service%256, endpoint%256)
+}
@@ -0,0 +1,154 @@
+// Package routingtest provides fixtures and a harness for testing code built on the
+// routing package, in the same spirit as net/http/httptest.
+package routingtest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+// Build an Ingress with a single rule which routes paths on a host to services in its
+// namespace.
+func Ingress(namespace, name, host string, paths map[string]string) extensions.Ingress {
+	var ps []string
+	for p := range paths {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+
+	var rule []extensions.HTTPIngressPath
+	for _, p := range ps {
+		rule = append(rule, extensions.HTTPIngressPath{
+			Path: p,
+			Backend: extensions.IngressBackend{
+				ServiceName: paths[p],
+			},
+		})
+	}
+
+	return extensions.Ingress{
+		ObjectMeta: api.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: extensions.IngressSpec{
+			Rules: []extensions.IngressRule{
+				extensions.IngressRule{
+					Host: host,
+					IngressRuleValue: extensions.IngressRuleValue{
+						HTTP: &extensions.HTTPIngressRuleValue{
+							Paths: rule,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Endpoints from a fixed list of pod addresses, keyed by upstream name.
+type Endpoints map[string][]string
+
+func (e Endpoints) Get(name string) ([]string, error) {
+	if addrs, ok := e[name]; ok {
+		return addrs, nil
+	}
+	return []string{}, errors.New(fmt.Sprintf("Cannot find the service: %s\n", name))
+}
+
+// A Harness routes requests to in-process echo backends the way a routing table says
+// they should be routed. It tests the routing table, not Nginx: locations are matched
+// with Backend.Match, their directives are not applied and the first address of an
+// upstream always answers, where Nginx would pick one by hashing the client address.
+//
+//	h := routingtest.NewHarness()
+//	defer h.Close()
+//	h.AddBackend("10.0.0.1:80", "web-0")
+//	h.Backend = routing.Build(ings, endpoints)
+//	resp, err := h.Get("example.com", "/")
+type Harness struct {
+	Backend routing.Backend
+
+	backends map[string]*httptest.Server
+}
+
+// The response from an echo backend.
+type Response struct {
+	StatusCode int
+
+	// The name of the echo backend which answered the request.
+	Backend string
+	Body    string
+}
+
+// Start an echo backend which answers for a pod address. It responds with the method,
+// host and path of each request.
+func (h *Harness) AddBackend(addr, name string) {
+	h.backends[addr] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", name)
+		fmt.Fprintf(w, "%s %s%s\n", r.Method, r.Host, r.URL.Path)
+	}))
+}
+
+// Send a request to the backend the routing table gives for a host and path. Requests
+// without a location get a 404 and upstreams without a running backend get a 502.
+func (h *Harness) Get(host, path string) (Response, error) {
+	location, ok := h.Backend.Match(host, path)
+	if !ok {
+		return Response{StatusCode: http.StatusNotFound}, nil
+	}
+
+	addrs := h.Backend.Upstreams[location.Upstream]
+	if len(addrs) <= 0 {
+		return Response{StatusCode: http.StatusBadGateway}, nil
+	}
+	backend, ok := h.backends[addrs[0]]
+	if !ok {
+		return Response{StatusCode: http.StatusBadGateway}, nil
+	}
+
+	req, err := http.NewRequest("GET", backend.URL+path, nil)
+	if err != nil {
+		return Response{}, err
+	}
+	req.Host = host
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Response{StatusCode: http.StatusBadGateway}, nil
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return Response{
+		StatusCode: resp.StatusCode,
+		Backend:    resp.Header.Get("X-Backend"),
+		Body:       string(body),
+	}, nil
+}
+
+// Stop the echo backends.
+func (h *Harness) Close() {
+	for _, b := range h.backends {
+		b.Close()
+	}
+}
+
+// Standard method for loading a Harness object.
+func NewHarness() *Harness {
+	return &Harness{
+		backends: make(map[string]*httptest.Server),
+	}
+}
@@ -0,0 +1,36 @@
+package routingtest
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+)
+
+func TestHarness(t *testing.T) {
+	h := NewHarness()
+	defer h.Close()
+
+	h.AddBackend("10.0.0.1:80", "web-0")
+	h.Backend = routing.Build([]extensions.Ingress{
+		Ingress("shop", "shop", "shop.example.com", map[string]string{
+			"/":    "web",
+			"/api": "api",
+		}),
+	}, Endpoints{
+		"shop-web": []string{"10.0.0.1:80"},
+		"shop-api": []string{"10.0.0.2:80"},
+	})
+
+	resp, err := h.Get("shop.example.com", "/cart")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "web-0", resp.Backend)
+	assert.Equal(t, "GET shop.example.com/cart\n", resp.Body)
+
+	resp, err = h.Get("shop.example.com", "/api")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode, "No backend is running for the upstream")
+}
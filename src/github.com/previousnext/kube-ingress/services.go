@@ -3,7 +3,12 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
 
+	"github.com/previousnext/kube-ingress/routing"
 	"k8s.io/kubernetes/pkg/api"
 	client "k8s.io/kubernetes/pkg/client/unversioned"
 	"k8s.io/kubernetes/pkg/fields"
@@ -12,8 +17,32 @@ import (
 )
 
 type Services struct {
-	Client *client.Client
+	Client client.Interface
 	List   map[string][]string
+
+	// How many services to load pods for at the same time, at least one.
+	Workers int
+
+	// Closed once the first full list of services has been loaded.
+	Synced chan struct{}
+
+	// Where progress is logged to, stdout when nil.
+	Log io.Writer
+
+	lock     sync.RWMutex
+	syncOnce sync.Once
+
+	// Held for a whole Load, so a slow poll can't replace the list from a resync
+	// which started after it.
+	loadLock sync.Mutex
+}
+
+func (s *Services) logf(format string, args ...interface{}) {
+	w := s.Log
+	if w == nil {
+		w = os.Stdout
+	}
+	fmt.Fprintf(w, format, args...)
 }
 
 func (s *Services) Start() {
@@ -22,56 +51,166 @@ func (s *Services) Start() {
 	for {
 		rl.Accept()
 
-		// First we need to load the services.
-		svcs, err := s.Client.Services("").List(labels.Everything())
+		err := s.Load()
 		if err != nil {
-			fmt.Printf("Error retrieving services: %v\n", err)
-			continue
+			s.logf("%v\n", err)
 		}
+	}
+}
 
-		// We build a fresh list every time to ensure we don't have any issues with old data.
-		newSvcs := make(map[string][]string)
+// Load the current list of services and the addresses of their running pods. Only
+// one Load runs at a time, a second waits for the first to finish.
+func (s *Services) Load() error {
+	s.loadLock.Lock()
+	defer s.loadLock.Unlock()
 
-		// Now we go over all the services and associate the pod IP addresses
-		// to each of the services.
-		for _, svc := range svcs.Items {
-			var addrs []string
+	// First we need to load the services.
+	svcs, err := s.Client.Services("").List(labels.Everything())
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error retrieving services: %v", err))
+	}
 
-			ps, err := s.Client.Pods(svc.ObjectMeta.Namespace).List(labels.SelectorFromSet(labels.Set(svc.Spec.Selector)), fields.Everything())
-			if err != nil {
-				fmt.Printf("Error retrieving service: %v\n", err)
-				continue
-			}
+	// We build a fresh list every time to ensure we don't have any issues with old data.
+	var (
+		newSvcs = make(map[string][]string)
+		loaded  int
+		lock    sync.Mutex
+		wg      sync.WaitGroup
+		queue   = make(chan api.Service)
+	)
+
+	// Now we go over all the services and associate the pod IP addresses
+	// to each of the services. Pods are loaded for multiple services at a time
+	// so large clusters don't take minutes to become ready.
+	workers := s.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for svc := range queue {
+				name, addrs, err := s.addresses(svc)
+
+				lock.Lock()
+				loaded++
+				if loaded%100 == 0 {
+					s.logf("Loaded pods for services: %d/%d\n", loaded, len(svcs.Items))
+				}
+				lock.Unlock()
 
-			name := MergeNameNameSpace(svc.ObjectMeta.Namespace, svc.ObjectMeta.Name)
+				if err != nil {
+					s.logf("Error retrieving service: %v\n", err)
+					continue
+				}
 
-			// Add all the running pods to the list.
-			for _, p := range ps.Items {
-				if p.Status.Phase != api.PodRunning {
-					fmt.Printf("Skipping pod %s for service %s\n", p.Name, name)
+				// Ensure we have some addresses, if we don't, we don't have to
+				// worry about adding this service.
+				if len(addrs) <= 0 {
+					s.logf("The service %s did not contain any upstream servers\n", name)
 					continue
 				}
-				fmt.Printf("Added pod %s for service %s\n", p.Name, name)
-				addrs = append(addrs, p.Status.PodIP+":80")
-			}
 
-			// Ensure we have some addresses, if we don't, we don't have to
-			// worry about adding this service.
-			if len(addrs) <= 0 {
-				fmt.Printf("The service %s did not contain any upstream servers\n", name)
-				continue
+				s.logf("Added the service: %v\n", name)
+				lock.Lock()
+				newSvcs[name] = addrs
+				lock.Unlock()
 			}
+		}()
+	}
+	for _, svc := range svcs.Items {
+		queue <- svc
+	}
+	close(queue)
+	wg.Wait()
+
+	// Now that we have built the list we can hand it over so be used for Get() requests.
+	s.lock.Lock()
+	s.List = newSvcs
+	s.lock.Unlock()
+
+	s.syncOnce.Do(func() {
+		close(s.Synced)
+	})
 
-			fmt.Printf("Added the service: %v\n", name)
-			newSvcs[name] = addrs
+	return nil
+}
+
+// Load the addresses of the running pods for a service.
+func (s *Services) addresses(svc api.Service) (string, []string, error) {
+	var addrs []string
+
+	name := routing.MergeNameNameSpace(svc.ObjectMeta.Namespace, svc.ObjectMeta.Name)
+
+	ps, err := s.Client.Pods(svc.ObjectMeta.Namespace).List(labels.SelectorFromSet(labels.Set(svc.Spec.Selector)), fields.Everything())
+	if err != nil {
+		return name, addrs, err
+	}
+
+	// Add all the running pods to the list.
+	for _, p := range ps.Items {
+		if p.Status.Phase != api.PodRunning {
+			s.logf("Skipping pod %s for service %s\n", p.Name, name)
+			continue
 		}
+		s.logf("Added pod %s for service %s\n", p.Name, name)
+		addrs = append(addrs, p.Status.PodIP+":80")
+	}
+
+	return name, addrs, nil
+}
+
+// Load the addresses for a single service, replacing anything we already know about it.
+func (s *Services) LoadService(namespace, name string) error {
+	svc, err := s.Client.Services(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+
+	n, addrs, err := s.addresses(*svc)
+	if err != nil {
+		return err
+	}
 
-		// Now that we have built the list we can hand it over so be used for Get() requests.
-		s.List = newSvcs
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(addrs) <= 0 {
+		delete(s.List, n)
+		return nil
+	}
+	s.List[n] = addrs
+	return nil
+}
+
+// Block until the first full list of services has been loaded, logging while we
+// wait. Returns false if the timeout was reached first.
+func (s *Services) WaitForSync(timeout time.Duration) bool {
+	var (
+		deadline = time.After(timeout)
+		progress = time.NewTicker(5 * time.Second)
+		start    = time.Now()
+	)
+	defer progress.Stop()
+
+	for {
+		select {
+		case <-s.Synced:
+			s.logf("Services synced after %v\n", time.Since(start))
+			return true
+		case <-progress.C:
+			s.logf("Waiting for services to sync: %v elapsed\n", time.Since(start))
+		case <-deadline:
+			return false
+		}
 	}
 }
 
 func (s *Services) Get(n string) ([]string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	if val, ok := s.List[n]; ok {
 		return val, nil
 	}
@@ -79,10 +218,12 @@ func (s *Services) Get(n string) ([]string, error) {
 }
 
 // Standard method for loading a Services object.
-func NewServices(c *client.Client) *Services {
+func NewServices(c client.Interface, workers int) *Services {
 	s := &Services{
-		Client: c,
-		List:   make(map[string][]string),
+		Client:  c,
+		List:    make(map[string][]string),
+		Workers: workers,
+		Synced:  make(chan struct{}),
 	}
 
 	// Start the continual process of pull the services and
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/unversioned/testclient"
+)
+
+func TestLoad(t *testing.T) {
+	objects := testclient.NewObjects(api.Scheme, api.Scheme)
+	for i := 0; i < 20; i++ {
+		selector := map[string]string{
+			"app": fmt.Sprintf("svc%d", i),
+		}
+		err := objects.Add(&api.Service{
+			ObjectMeta: api.ObjectMeta{
+				Name:      fmt.Sprintf("svc%d", i),
+				Namespace: "default",
+			},
+			Spec: api.ServiceSpec{
+				Selector: selector,
+			},
+		})
+		assert.Nil(t, err)
+
+		// Every other service has no running pods.
+		phase := api.PodRunning
+		if i%2 == 1 {
+			phase = api.PodPending
+		}
+		err = objects.Add(&api.Pod{
+			ObjectMeta: api.ObjectMeta{
+				Name:      fmt.Sprintf("svc%d-0", i),
+				Namespace: "default",
+				Labels:    selector,
+			},
+			Status: api.PodStatus{
+				Phase: phase,
+				PodIP: fmt.Sprintf("10.0.0.%d", i),
+			},
+		})
+		assert.Nil(t, err)
+	}
+
+	c := &testclient.Fake{}
+	c.AddReactor("*", "*", testclient.ObjectReaction(objects, api.RESTMapper))
+
+	s := &Services{
+		Client:  c,
+		List:    make(map[string][]string),
+		Workers: 4,
+		Synced:  make(chan struct{}),
+	}
+	err := s.Load()
+	assert.Nil(t, err)
+
+	assert.Len(t, s.List, 10, "Services without running pods are left out")
+	assert.Equal(t, []string{"10.0.0.4:80"}, s.List["default-svc4"])
+	assert.True(t, s.WaitForSync(10*time.Millisecond), "Loading marks the services as synced")
+
+	s.Workers = 0
+	err = s.Load()
+	assert.Nil(t, err, "Loads with a single worker when none are configured")
+	assert.Len(t, s.List, 10)
+}
+
+func TestWaitForSync(t *testing.T) {
+	s := &Services{
+		Synced: make(chan struct{}),
+	}
+	assert.False(t, s.WaitForSync(10*time.Millisecond), "Services have not synced yet")
+
+	close(s.Synced)
+	assert.True(t, s.WaitForSync(10*time.Millisecond), "Services have synced")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// The size of the configuration if all the fragments were rendered into a single file.
+func (f Fragments) Size() int {
+	var size int
+	for _, s := range f.Servers {
+		size += len(s)
+	}
+	for _, u := range f.Upstreams {
+		size += len(u)
+	}
+	return size
+}
+
+// Whether the fragments are large enough to be written to the shard directory.
+func (n *Nginx) Sharded(f Fragments) bool {
+	return n.ShardSize > 0 && f.Size() > n.ShardSize
+}
+
+// The include files for the fragments, keyed by their path in the shard directory.
+func (n *Nginx) Shards(f Fragments) map[string]string {
+	files := make(map[string]string)
+	for name, s := range f.Servers {
+		files[filepath.Join(n.ShardDir, "server-"+name+".conf")] = s
+	}
+	for name, u := range f.Upstreams {
+		files[filepath.Join(n.ShardDir, "upstream-"+name+".conf")] = u
+	}
+	return files
+}
+
+// The include files in a shard directory which were written by WriteShards. Other
+// files in the directory are left alone, in case it is shared with other
+// configuration such as /etc/nginx/conf.d.
+func shardFiles(dir string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"server-*.conf", "upstream-*.conf"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return files, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// Write each server and upstream fragment to its own file in the shard directory so
+// they can be loaded by an include. Files are only written when their contents have
+// changed and files for servers and upstreams which no longer exist are removed.
+func (n *Nginx) WriteShards(f Fragments) error {
+	err := os.MkdirAll(n.ShardDir, 0755)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Failed to create %v: %v\n", n.ShardDir, err))
+	}
+
+	files := n.Shards(f)
+	for path, contents := range files {
+		if existing, err := ioutil.ReadFile(path); err == nil && string(existing) == contents {
+			continue
+		}
+
+		err := ioutil.WriteFile(path, []byte(contents), 0644)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed to write %v: %v\n", path, err))
+		}
+	}
+
+	// Clean up the files from servers and upstreams which have been removed.
+	existing, err := shardFiles(n.ShardDir)
+	if err != nil {
+		return err
+	}
+	for _, path := range existing {
+		if _, ok := files[path]; ok {
+			continue
+		}
+
+		err := os.Remove(path)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed to remove %v: %v\n", path, err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteShards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kube-ingress")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// A leftover from a server which has since been removed.
+	err = ioutil.WriteFile(filepath.Join(dir, "server-old.conf"), []byte("old"), 0644)
+	assert.Nil(t, err)
+
+	// Configuration which belongs to someone else.
+	err = ioutil.WriteFile(filepath.Join(dir, "custom.conf"), []byte("custom"), 0644)
+	assert.Nil(t, err)
+
+	n := Nginx{
+		ShardDir: dir,
+	}
+	err = n.WriteShards(Fragments{
+		Servers: map[string]string{
+			"server1": "server1 fragment",
+		},
+		Upstreams: map[string]string{
+			"foo": "foo fragment",
+		},
+	})
+	assert.Nil(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "custom.conf"),
+		filepath.Join(dir, "server-server1.conf"),
+		filepath.Join(dir, "upstream-foo.conf"),
+	}, files, "Only the current servers and upstreams are kept, other files are left alone")
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "server-server1.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, "server1 fragment", string(contents))
+}
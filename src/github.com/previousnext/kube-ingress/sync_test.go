@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/previousnext/kube-ingress/routing"
+	"github.com/previousnext/kube-ingress/routing/routingtest"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+	"k8s.io/kubernetes/pkg/client/unversioned/testclient"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// Generate a cluster with routingtest.Cluster, with the endpoints loaded into Services.
+func generateCluster(ingresses, endpoints int) ([]extensions.Ingress, *Services) {
+	ings, eps := routingtest.Cluster(ingresses, endpoints)
+	return ings, &Services{
+		List: eps,
+	}
+}
+
+// A fake Kubernetes client which serves the objects.
+func fakeClient(objs []runtime.Object) (*testclient.Fake, error) {
+	objects := testclient.NewObjects(api.Scheme, api.Scheme)
+	for _, obj := range objs {
+		err := objects.Add(obj)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c := &testclient.Fake{}
+	c.AddReactor("*", "*", testclient.ObjectReaction(objects, api.RESTMapper))
+	return c, nil
+}
+
+// Load the services and the addresses of their pods from the Kubernetes API, here
+// a fake client serving the generated cluster. The fake client filters every object
+// on each list, so this stops at 100 services before it dominates the measurement.
+func benchmarkLoad(b *testing.B, services, endpoints int) {
+	c, err := fakeClient(routingtest.ClusterObjects(services, endpoints))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	s := &Services{
+		Client:  c,
+		List:    make(map[string][]string),
+		Workers: 10,
+		Synced:  make(chan struct{}),
+		Log:     ioutil.Discard,
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := s.Load()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Run the sync path from the loaded services on: build the backend from the cluster,
+// render it and write the configuration to memory. Loading the services is measured
+// by benchmarkLoad, writing shards to disk and reloading Nginx are not measured.
+// Every iteration starts from an empty fragment cache.
+func benchmarkSync(b *testing.B, ingresses, endpoints int) {
+	ings, svcs := generateCluster(ingresses, endpoints)
+
+	n, err := NewNginx("80", "", 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.Fragments = Fragments{}
+
+		backend := routing.Build(ings, svcs)
+		n.SetServers(backend.Servers)
+		n.SetUpstreams(backend.Upstreams)
+
+		f, err := n.Render()
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = n.Write(ioutil.Discard, f)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Run the sync path when a single service has changed since the last reload, so
+// every other fragment comes from the cache.
+func benchmarkSyncIncremental(b *testing.B, ingresses, endpoints int) {
+	ings, svcs := generateCluster(ingresses, endpoints)
+
+	n, err := NewNginx("80", "", 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	backend := routing.Build(ings, svcs)
+	n.SetServers(backend.Servers)
+	n.SetUpstreams(backend.Upstreams)
+	n.Fragments, err = n.Render()
+	if err != nil {
+		b.Fatal(err)
+	}
+	n.Prev = backend
+
+	// Pod churn on the first service.
+	name := routing.MergeNameNameSpace("ns0", "svc0")
+	svcs.List[name] = append([]string{"10.255.255.255:80"}, svcs.List[name][1:]...)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		backend := routing.Build(ings, svcs)
+		n.SetServers(backend.Servers)
+		n.SetUpstreams(backend.Upstreams)
+
+		f, err := n.Render()
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = n.Write(ioutil.Discard, f)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoad10(b *testing.B)  { benchmarkLoad(b, 10, 3) }
+func BenchmarkLoad100(b *testing.B) { benchmarkLoad(b, 100, 10) }
+
+func BenchmarkSync10(b *testing.B)   { benchmarkSync(b, 10, 3) }
+func BenchmarkSync100(b *testing.B)  { benchmarkSync(b, 100, 10) }
+func BenchmarkSync1000(b *testing.B) { benchmarkSync(b, 1000, 10) }
+
+func BenchmarkSyncIncremental10(b *testing.B)   { benchmarkSyncIncremental(b, 10, 3) }
+func BenchmarkSyncIncremental100(b *testing.B)  { benchmarkSyncIncremental(b, 100, 10) }
+func BenchmarkSyncIncremental1000(b *testing.B) { benchmarkSyncIncremental(b, 1000, 10) }
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"sort"
 )
 
 // Helper function execute commands on the commandline.
@@ -15,7 +16,17 @@ func shellOut(cmd string) error {
 	return nil
 }
 
-// Helper to merge the name and namespace of a service.
-func MergeNameNameSpace(ns, n string) string {
-	return ns + "-" + n
+// Helper to return the values of a map, ordered by their keys.
+func sortedValues(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var values []string
+	for _, k := range keys {
+		values = append(values, m[k])
+	}
+	return values
 }